@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/config"
+	"github.com/KarmaBeLike/SongLibrary/internal/auth"
+	"github.com/KarmaBeLike/SongLibrary/internal/database"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/KarmaBeLike/SongLibrary/internal/repository"
+)
+
+const usage = `usage:
+  apikey create -name NAME -scopes read,write,admin
+  apikey list
+  apikey revoke -id ID`
+
+// apikey manages API keys directly in the database, e.g. to create the first
+// admin key before anyone can call the admin endpoints.
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		fail(err)
+	}
+	db, err := database.OpenDB(cfg)
+	if err != nil {
+		fail(err)
+	}
+	defer db.Close()
+
+	keys := auth.NewKeys(repository.NewAPIKeyRepository(db))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "create":
+		fs := flag.NewFlagSet("create", flag.ExitOnError)
+		name := fs.String("name", "", "who or what the key is for")
+		scopes := fs.String("scopes", models.ScopeRead, "comma-separated scopes: read, write, admin")
+		fs.Parse(args)
+
+		key, err := keys.Create(ctx, models.NewAPIKeyRequest{Name: *name, Scopes: strings.Split(*scopes, ",")})
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("Created key %d (%s) with scopes %s.\n", key.ID, key.Name, strings.Join(key.Scopes, ","))
+		fmt.Println("Store it now, it is not shown again:")
+		fmt.Println(key.Key)
+
+	case "list":
+		list, err := keys.List(ctx)
+		if err != nil {
+			fail(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tCREATED\tLAST USED\tREVOKED")
+		for _, key := range list {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Prefix, strings.Join(key.Scopes, ","),
+				key.CreatedAt.Format(time.DateTime), formatTime(key.LastUsedAt), formatTime(key.RevokedAt))
+		}
+		w.Flush()
+
+	case "revoke":
+		fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+		id := fs.Int("id", 0, "ID of the key to revoke")
+		fs.Parse(args)
+
+		if err := keys.Revoke(ctx, *id); err != nil {
+			fail(err)
+		}
+		fmt.Printf("Revoked key %d.\n", *id)
+
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.DateTime)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
@@ -1,19 +1,38 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/KarmaBeLike/SongLibrary/config"
 	_ "github.com/KarmaBeLike/SongLibrary/docs"
 	"github.com/KarmaBeLike/SongLibrary/internal/api"
+	"github.com/KarmaBeLike/SongLibrary/internal/auth"
 	"github.com/KarmaBeLike/SongLibrary/internal/database"
+	"github.com/KarmaBeLike/SongLibrary/internal/enrichment"
+	"github.com/KarmaBeLike/SongLibrary/internal/feed"
+	"github.com/KarmaBeLike/SongLibrary/internal/health"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/metrics"
+	"github.com/KarmaBeLike/SongLibrary/internal/outbox"
+	"github.com/KarmaBeLike/SongLibrary/internal/ratelimit"
 	"github.com/KarmaBeLike/SongLibrary/internal/repository"
+	"github.com/KarmaBeLike/SongLibrary/internal/resync"
 	"github.com/KarmaBeLike/SongLibrary/internal/routers"
 	"github.com/KarmaBeLike/SongLibrary/internal/service"
+	"github.com/KarmaBeLike/SongLibrary/internal/tracing"
+	"github.com/KarmaBeLike/SongLibrary/internal/webhook"
 )
 
 // @title SongLibrary
@@ -22,19 +41,43 @@ import (
 // @host localhost:8080
 // @BasePath /
 func main() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelDebug,
-	}))
+	cfg, err := config.LoadServer(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, config.ErrHelp) {
+			return
+		}
+		slog.Error("failed to load config", slog.Any("error", err))
+		os.Exit(2)
+	}
+
+	logger, err := logging.New(os.Stdout, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		slog.Error("failed to set up logging", slog.Any("error", err))
+		os.Exit(2)
+	}
 
 	slog.SetDefault(logger)
 
-	slog.Info("Logger initialized", slog.String("output", "JSON"))
+	slog.Info("Logger initialized", slog.String("level", cfg.LogLevel), slog.String("format", cfg.LogFormat))
 
-	cfg, err := config.Load()
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: "songlibrary",
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		SampleRate:  cfg.TracingSampleRate,
+	})
 	if err != nil {
-		slog.Error("failed to load config", slog.Any("error", err))
+		slog.Error("failed to set up tracing", slog.Any("error", err))
 		return
 	}
+	defer func() {
+		// Flush the spans still buffered.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to flush traces", slog.Any("error", err))
+		}
+	}()
 
 	db, err := database.OpenDB(cfg)
 	if err != nil {
@@ -42,6 +85,7 @@ func main() {
 		return
 	}
 	defer db.Close()
+	metrics.RegisterDB(db, cfg.DBName)
 
 	if err := database.RunMigrations(db); err != nil {
 		slog.Error("error running migrations", slog.Any("error", err))
@@ -53,16 +97,319 @@ func main() {
 	}
 
 	songRepo := repository.NewSongRepository(db)
-	apiClient := api.NewExternalAPI(cfg.ExternalAPI)
-	fmt.Println(cfg.ExternalAPI)
-	songService := service.NewSongService(songRepo, apiClient)
-	router := routers.SetupRoutes(songService)
+	providers, err := setupProviders(cfg)
+	if err != nil {
+		slog.Error("failed to set up song detail providers", slog.Any("error", err))
+		return
+	}
+	songService := service.NewSongService(songRepo, providers.details, service.WithEnrichAttempts(cfg.EnrichMaxAttempts))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// background is stopped after the HTTP server on shutdown.
+	var background []waiter
+
+	enrichPool := enrichment.NewPool(repository.NewJobRepository(db), songService, enrichment.Config{
+		Workers:       cfg.EnrichWorkers,
+		PollInterval:  cfg.EnrichPollInterval,
+		Lease:         cfg.EnrichLease,
+		RetryDelay:    cfg.EnrichRetryDelay,
+		MaxRetryDelay: cfg.EnrichMaxRetryDelay,
+	})
+	enrichPool.Start(ctx)
+	background = append(background, enrichPool)
+
+	scheduler := resync.NewScheduler(songService, repository.NewSyncRunRepository(db), resync.Config{
+		Interval:  cfg.SyncInterval,
+		Rate:      cfg.SyncRate,
+		BatchSize: cfg.SyncBatchSize,
+	})
+	scheduler.Start(ctx)
+	background = append(background, scheduler)
+
+	webhooks := webhook.NewDispatcher(repository.NewWebhookRepository(db), webhook.Config{
+		Workers:             cfg.WebhookWorkers,
+		MaxAttempts:         cfg.WebhookMaxAttempts,
+		Timeout:             cfg.WebhookTimeout,
+		PollInterval:        cfg.WebhookPollInterval,
+		RetryDelay:          cfg.WebhookRetryDelay,
+		MaxRetryDelay:       cfg.WebhookMaxRetryDelay,
+		AllowPrivateTargets: cfg.WebhookAllowPrivateTargets,
+	})
+	webhooks.Start(ctx)
+	background = append(background, webhooks)
+
+	// With NOTIFY every instance feeds its event stream clients from the
+	// channel, otherwise the relay feeds them directly.
+	broker := feed.NewBroker(feed.Config{
+		Retain:       cfg.FeedRetain,
+		ClientBuffer: cfg.FeedClientBuffer,
+	})
+	publishers := outbox.Fanout{webhooks}
+	if cfg.OutboxNotifyChannel != "" {
+		publishers = append(publishers, outbox.NewPostgresPublisher(db, cfg.OutboxNotifyChannel))
+		listener := outbox.NewListener(database.DSN(cfg), cfg.OutboxNotifyChannel, broker)
+		if err := listener.Start(ctx); err != nil {
+			slog.Error("failed to listen for change events", slog.Any("error", err))
+			return
+		}
+		background = append(background, listener)
+	} else {
+		publishers = append(publishers, broker)
+	}
+	relay := outbox.NewRelay(repository.NewOutboxRepository(db), publishers, outbox.Config{
+		PollInterval: cfg.OutboxPollInterval,
+		BatchSize:    cfg.OutboxBatchSize,
+		Retention:    cfg.OutboxRetention,
+	})
+	relay.Start(ctx)
+	background = append(background, relay)
+
+	// The config requires a secret when auth is enabled.
+	jwtSecret := []byte(cfg.JWTSecret)
+	if len(jwtSecret) == 0 {
+		slog.Warn("JWT_SECRET is not set and auth is disabled, using a random secret: sessions end when the server restarts")
+		jwtSecret = make([]byte, 32)
+		if _, err := rand.Read(jwtSecret); err != nil {
+			slog.Error("failed to generate jwt secret", slog.Any("error", err))
+			return
+		}
+	}
+	userRepo := repository.NewUserRepository(db)
+	sessions := auth.NewSessions(userRepo, auth.SessionConfig{
+		Secret:       jwtSecret,
+		Issuer:       cfg.JWTIssuer,
+		AccessTTL:    cfg.AccessTokenTTL,
+		RefreshTTL:   cfg.RefreshTokenTTL,
+		Registration: cfg.Registration,
+	})
+
+	limiter, err := setupRateLimiter(cfg, db)
+	if err != nil {
+		slog.Error("failed to set up rate limiting", slog.Any("error", err))
+		return
+	}
+
+	checker, err := setupHealth(cfg, db, providers.clients)
+	if err != nil {
+		slog.Error("failed to set up health checks", slog.Any("error", err))
+		return
+	}
+
+	var proxyHops int
+	if cfg.TrustProxy {
+		proxyHops = cfg.TrustProxyHops
+	}
+
+	router := routers.SetupRoutes(routers.Deps{
+		SongService: songService,
+		Breakers:    providers.breakers,
+		Caches:      providers.caches,
+		Enrichment:  enrichPool,
+		Resync:      scheduler,
+		Webhooks:    webhooks,
+		Events:      broker,
+		APIKeys:     auth.NewKeys(repository.NewAPIKeyRepository(db)),
+		Sessions:    sessions,
+		Roles:       auth.NewRoles(userRepo),
+		Health:      checker,
+		RateLimiter: limiter,
+		ProxyHops:   proxyHops,
+		AuthEnabled: cfg.AuthEnabled,
+	})
+	if !cfg.AuthEnabled {
+		slog.Warn("Authentication is disabled, every route is open")
+	}
 
 	port := cfg.Port
-	log.Printf("Server is running on port %d...", port)
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           router,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}
+	// Event streams never finish by themselves, end them when shutting down.
+	server.RegisterOnShutdown(broker.Close)
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
 
-	err = http.ListenAndServe(fmt.Sprintf(":%d", port), router)
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server is running on port %d...", port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		slog.Error("server failed", slog.Any("error", err))
+		return
+	case <-signals.Done():
+	}
+	// A second signal kills the process right away.
+	stopSignals()
+
+	shutdown(cfg, server, checker, cancel, background)
+}
+
+type waiter interface {
+	Wait()
+}
+
+// shutdown stops the service in order within cfg.ShutdownTimeout: it reports
+// not ready, drains the HTTP requests, then stops the background work. The
+// database and the tracer are closed by main's deferred calls afterwards.
+func shutdown(cfg *config.Config, server *http.Server, checker *health.Checker, cancel context.CancelFunc, background []waiter) {
+	slog.Info("Shutting down", slog.Duration("timeout", cfg.ShutdownTimeout))
+	ctx, done := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer done()
+
+	checker.Drain()
+	select {
+	case <-time.After(cfg.ShutdownDrainDelay):
+	case <-ctx.Done():
+	}
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("HTTP requests did not finish in time", slog.Any("error", err))
+	} else {
+		slog.Info("HTTP server stopped")
+	}
+
+	cancel()
+	stopped := make(chan struct{})
+	go func() {
+		for _, w := range background {
+			w.Wait()
+		}
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		slog.Info("Background work stopped")
+	case <-ctx.Done():
+		slog.Error("Background work did not stop in time")
+	}
+}
+
+// setupRateLimiter returns the limiter for the configured backend, nil when
+// rate limiting is off.
+func setupRateLimiter(cfg *config.Config, db *sql.DB) (*ratelimit.Limiter, error) {
+	var store ratelimit.Store
+	switch cfg.RateLimitBackend {
+	case "off", "":
+		slog.Warn("Rate limiting is disabled")
+		return nil, nil
+	case "memory":
+		store = ratelimit.NewMemoryStore()
+	case "postgres":
+		store = ratelimit.NewPostgresStore(db)
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q, expected off, memory or postgres", cfg.RateLimitBackend)
+	}
+
+	return ratelimit.NewLimiter(store, map[string]ratelimit.Limit{
+		ratelimit.Read:     {Rate: cfg.RateLimitReadRate, Burst: cfg.RateLimitReadBurst},
+		ratelimit.Write:    {Rate: cfg.RateLimitWriteRate, Burst: cfg.RateLimitWriteBurst},
+		ratelimit.Upstream: {Rate: cfg.RateLimitUpstreamRate, Burst: cfg.RateLimitUpstreamBurst},
+	}), nil
+}
+
+// setupHealth builds the readiness checks: the database answers and is
+// migrated to the newest migration, and optionally every provider is reachable.
+func setupHealth(cfg *config.Config, db *sql.DB, clients []*api.ExternalAPI) (*health.Checker, error) {
+	latest, err := database.LatestMigration(database.MigrationsDir)
 	if err != nil {
-		log.Fatal("Error starting server: ", err)
+		return nil, err
+	}
+
+	checks := []health.Check{
+		{Name: "database", Timeout: cfg.HealthCheckTimeout, Func: db.PingContext},
+		{Name: "migrations", Timeout: cfg.HealthCheckTimeout, Func: func(ctx context.Context) error {
+			version, dirty, err := database.MigrationVersion(ctx, db)
+			switch {
+			case err != nil:
+				return err
+			case dirty:
+				return fmt.Errorf("migration %d failed halfway", version)
+			case version < latest:
+				return fmt.Errorf("database is at migration %d, expected %d", version, latest)
+			}
+			return nil
+		}},
+	}
+	if cfg.HealthCheckProviders {
+		for _, client := range clients {
+			checks = append(checks, health.Check{Name: "provider " + client.Name(), Timeout: cfg.HealthCheckTimeout, Func: client.Ping})
+		}
+	}
+	return health.NewChecker(checks...), nil
+}
+
+type providerSet struct {
+	details  []service.DetailProvider
+	breakers []*api.CircuitBreaker
+	caches   []*api.CachedFetcher
+	clients  []*api.ExternalAPI
+}
+
+// setupProviders builds the song detail providers from the configuration.
+// Every provider gets its own retrying client, circuit breaker and cache.
+func setupProviders(cfg *config.Config) (*providerSet, error) {
+	set := &providerSet{}
+
+	for _, p := range cfg.Providers {
+		var transport http.RoundTripper
+		if cfg.APIVCRMode != "" && cfg.APIVCRMode != api.VCRModeOff {
+			recorder, err := api.NewRecorder(cfg.APIVCRMode, filepath.Join(cfg.APIVCRDir, p.Name+".json"), nil)
+			if err != nil {
+				return nil, fmt.Errorf("provider %s: %w", p.Name, err)
+			}
+			slog.Info("External API requests go through the recorder", slog.String("provider", p.Name), slog.String("mode", cfg.APIVCRMode))
+			transport = recorder
+		}
+
+		retry := api.RetryPolicy{
+			MaxRetries: cfg.APIMaxRetries,
+			BaseDelay:  cfg.APIRetryBaseDelay,
+			MaxDelay:   cfg.APIRetryMaxDelay,
+		}
+		client := api.NewExternalAPI(api.Config{
+			Name:       p.Name,
+			BaseURL:    p.BaseURL,
+			GroupParam: p.GroupParam,
+			SongParam:  p.SongParam,
+			Fields: api.FieldMapping{
+				ReleaseDate: p.Fields.ReleaseDate,
+				Text:        p.Fields.Text,
+				Link:        p.Fields.Link,
+			},
+			DateFormat: p.DateFormat,
+			Timeout:    cfg.APITimeout,
+			Retry:      retry,
+			Transport:  transport,
+		})
+		breaker := api.NewCircuitBreaker(p.Name, client, api.BreakerConfig{
+			FailureRate:      cfg.BreakerFailureRate,
+			WindowSize:       cfg.BreakerWindowSize,
+			MinRequests:      cfg.BreakerMinRequests,
+			CoolDown:         cfg.BreakerCoolDown,
+			HalfOpenRequests: cfg.BreakerHalfOpenRequests,
+		})
+		cache := api.NewCachedFetcher(p.Name, breaker, api.CacheConfig{
+			Size:         cfg.CacheSize,
+			TTL:          cfg.CacheTTL,
+			NegativeTTL:  cfg.CacheNegativeTTL,
+			FetchTimeout: api.FetchBudget(cfg.APITimeout, retry),
+		})
+
+		set.details = append(set.details, service.DetailProvider{Name: p.Name, Fetcher: cache})
+		set.breakers = append(set.breakers, breaker)
+		set.caches = append(set.caches, cache)
+		set.clients = append(set.clients, client)
 	}
+
+	return set, nil
 }
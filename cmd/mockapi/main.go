@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/mockapi"
+)
+
+// mockapi serves the song details provider contract from local fixtures so the
+// library can be run and tested without the real provider.
+func main() {
+	addr := flag.String("addr", ":8081", "address to listen on")
+	fixturesDir := flag.String("fixtures", "fixtures/mockapi", "directory with *.json song fixtures")
+	latency := flag.Duration("latency", 0, "delay added to every response")
+	jitter := flag.Duration("jitter", 0, "random extra delay, up to this value")
+	errorRate := flag.Float64("error-rate", 0, "share of requests answered with -error-status, from 0 to 1")
+	errorStatus := flag.Int("error-status", http.StatusInternalServerError, "status code of injected errors")
+	retryAfter := flag.Duration("retry-after", 0, "Retry-After sent with injected 429 and 503 responses")
+	seed := flag.Uint64("seed", 0, "random seed for latency and errors, 0 picks one")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+	slog.SetDefault(logger)
+
+	fixtures, err := mockapi.LoadFixtures(*fixturesDir)
+	if err != nil {
+		slog.Error("failed to load fixtures", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	server := mockapi.NewServer(fixtures, mockapi.Options{
+		Latency:     *latency,
+		Jitter:      *jitter,
+		ErrorRate:   *errorRate,
+		ErrorStatus: *errorStatus,
+		RetryAfter:  *retryAfter,
+		Seed:        *seed,
+	})
+
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	slog.Info("Mock API is running", slog.String("addr", *addr), slog.Int("fixtures", len(fixtures)))
+	if err := httpServer.ListenAndServe(); err != nil {
+		slog.Error("mock API stopped", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
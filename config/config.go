@@ -1,8 +1,15 @@
 package config
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
 
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -14,26 +21,374 @@ type Config struct {
 	DBUser      string `mapstructure:"DB_USER"`
 	DBPassword  string `mapstructure:"DB_PASSWORD"`
 	ExternalAPI string `mapstructure:"API_URL"`
+	// DBPasswordFile holds the password instead of DB_PASSWORD, e.g. a mounted secret.
+	DBPasswordFile string `mapstructure:"DB_PASSWORD_FILE"`
+	// Connection pool of the service. DBConnectTimeout limits opening a connection.
+	DBMaxOpenConns    int           `mapstructure:"DB_MAX_OPEN_CONNS"`
+	DBMaxIdleConns    int           `mapstructure:"DB_MAX_IDLE_CONNS"`
+	DBConnMaxLifetime time.Duration `mapstructure:"DB_CONN_MAX_LIFETIME"`
+	DBConnMaxIdleTime time.Duration `mapstructure:"DB_CONN_MAX_IDLE_TIME"`
+	DBConnectTimeout  time.Duration `mapstructure:"DB_CONNECT_TIMEOUT"`
+
+	// LogLevel is debug, info, warn or error, LogFormat json or text.
+	LogLevel  string `mapstructure:"LOG_LEVEL"`
+	LogFormat string `mapstructure:"LOG_FORMAT"`
+
+	// ProvidersFile is a JSON file listing song detail providers in the order
+	// they are asked. Without it API_URL is the only provider.
+	ProvidersFile string           `mapstructure:"API_PROVIDERS_FILE"`
+	Providers     []ProviderConfig `mapstructure:"-"`
+
+	APITimeout        time.Duration `mapstructure:"API_TIMEOUT"`
+	APIMaxRetries     int           `mapstructure:"API_MAX_RETRIES"`
+	APIRetryBaseDelay time.Duration `mapstructure:"API_RETRY_BASE_DELAY"`
+	APIRetryMaxDelay  time.Duration `mapstructure:"API_RETRY_MAX_DELAY"`
+	// APIVCRMode is off, record or replay. Cassettes are kept per provider in APIVCRDir.
+	APIVCRMode string `mapstructure:"API_VCR_MODE"`
+	APIVCRDir  string `mapstructure:"API_VCR_DIR"`
+
+	BreakerFailureRate      float64       `mapstructure:"BREAKER_FAILURE_RATE"`
+	BreakerWindowSize       int           `mapstructure:"BREAKER_WINDOW_SIZE"`
+	BreakerMinRequests      int           `mapstructure:"BREAKER_MIN_REQUESTS"`
+	BreakerCoolDown         time.Duration `mapstructure:"BREAKER_COOL_DOWN"`
+	BreakerHalfOpenRequests int           `mapstructure:"BREAKER_HALF_OPEN_REQUESTS"`
+
+	CacheSize        int           `mapstructure:"CACHE_SIZE"`
+	CacheTTL         time.Duration `mapstructure:"CACHE_TTL"`
+	CacheNegativeTTL time.Duration `mapstructure:"CACHE_NEGATIVE_TTL"`
+
+	EnrichWorkers       int           `mapstructure:"ENRICH_WORKERS"`
+	EnrichMaxAttempts   int           `mapstructure:"ENRICH_MAX_ATTEMPTS"`
+	EnrichRetryDelay    time.Duration `mapstructure:"ENRICH_RETRY_DELAY"`
+	EnrichMaxRetryDelay time.Duration `mapstructure:"ENRICH_MAX_RETRY_DELAY"`
+	EnrichPollInterval  time.Duration `mapstructure:"ENRICH_POLL_INTERVAL"`
+	EnrichLease         time.Duration `mapstructure:"ENRICH_LEASE"`
+
+	// SyncInterval is the pause between runs filling in missing song details,
+	// zero disables them. SyncRate limits provider lookups per second.
+	SyncInterval  time.Duration `mapstructure:"SYNC_INTERVAL"`
+	SyncRate      float64       `mapstructure:"SYNC_RATE"`
+	SyncBatchSize int           `mapstructure:"SYNC_BATCH_SIZE"`
+
+	WebhookWorkers       int           `mapstructure:"WEBHOOK_WORKERS"`
+	WebhookMaxAttempts   int           `mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookTimeout       time.Duration `mapstructure:"WEBHOOK_TIMEOUT"`
+	WebhookPollInterval  time.Duration `mapstructure:"WEBHOOK_POLL_INTERVAL"`
+	WebhookRetryDelay    time.Duration `mapstructure:"WEBHOOK_RETRY_DELAY"`
+	WebhookMaxRetryDelay time.Duration `mapstructure:"WEBHOOK_MAX_RETRY_DELAY"`
+	// WebhookAllowPrivateTargets permits subscriptions to loopback and private
+	// addresses, meant for local development.
+	WebhookAllowPrivateTargets bool `mapstructure:"WEBHOOK_ALLOW_PRIVATE_TARGETS"`
+
+	OutboxPollInterval time.Duration `mapstructure:"OUTBOX_POLL_INTERVAL"`
+	OutboxBatchSize    int           `mapstructure:"OUTBOX_BATCH_SIZE"`
+	OutboxRetention    time.Duration `mapstructure:"OUTBOX_RETENTION"`
+	// OutboxNotifyChannel is the Postgres channel change events are sent to
+	// with NOTIFY, empty disables it.
+	OutboxNotifyChannel string `mapstructure:"OUTBOX_NOTIFY_CHANNEL"`
+
+	// FeedRetain is how many recent events /api/events keeps for clients
+	// resuming with Last-Event-ID.
+	FeedRetain       int `mapstructure:"FEED_RETAIN"`
+	FeedClientBuffer int `mapstructure:"FEED_CLIENT_BUFFER"`
+
+	// AuthEnabled requires an API key on every route except the docs.
+	AuthEnabled bool `mapstructure:"AUTH_ENABLED"`
+	// JWTSecret signs user tokens, it is required with AuthEnabled. Without
+	// auth a random secret is used and every session ends with a restart.
+	JWTSecret       string        `mapstructure:"JWT_SECRET"`
+	JWTSecretFile   string        `mapstructure:"JWT_SECRET_FILE"`
+	JWTIssuer       string        `mapstructure:"JWT_ISSUER"`
+	AccessTokenTTL  time.Duration `mapstructure:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `mapstructure:"REFRESH_TOKEN_TTL"`
+	// Registration lets anyone create a user account.
+	Registration bool `mapstructure:"AUTH_REGISTRATION"`
+
+	// RateLimitBackend is off, memory or postgres. Postgres shares the limits
+	// between instances. Rates are tokens per second, bursts the bucket size.
+	RateLimitBackend       string  `mapstructure:"RATE_LIMIT_BACKEND"`
+	RateLimitReadRate      float64 `mapstructure:"RATE_LIMIT_READ_RATE"`
+	RateLimitReadBurst     int     `mapstructure:"RATE_LIMIT_READ_BURST"`
+	RateLimitWriteRate     float64 `mapstructure:"RATE_LIMIT_WRITE_RATE"`
+	RateLimitWriteBurst    int     `mapstructure:"RATE_LIMIT_WRITE_BURST"`
+	RateLimitUpstreamRate  float64 `mapstructure:"RATE_LIMIT_UPSTREAM_RATE"`
+	RateLimitUpstreamBurst int     `mapstructure:"RATE_LIMIT_UPSTREAM_BURST"`
+	// TrustProxy takes the client IP from X-Forwarded-For, TrustProxyHops
+	// entries from the right: the number of proxies appending to it.
+	TrustProxy     bool `mapstructure:"TRUST_PROXY"`
+	TrustProxyHops int  `mapstructure:"TRUST_PROXY_HOPS"`
+
+	// TracingExporter is none, stdout or otlp. TracingSampleRate is the share
+	// of requests traced, from 0 to 1.
+	TracingExporter   string  `mapstructure:"TRACING_EXPORTER"`
+	TracingEndpoint   string  `mapstructure:"TRACING_ENDPOINT"`
+	TracingSampleRate float64 `mapstructure:"TRACING_SAMPLE_RATE"`
+
+	// HealthCheckTimeout limits each readiness check. With
+	// HealthCheckProviders the song detail providers must be reachable too.
+	HealthCheckTimeout   time.Duration `mapstructure:"HEALTH_CHECK_TIMEOUT"`
+	HealthCheckProviders bool          `mapstructure:"HEALTH_CHECK_PROVIDERS"`
+
+	// HTTP server timeouts. The read and write timeouts do not apply to
+	// /api/events streams.
+	HTTPReadHeaderTimeout time.Duration `mapstructure:"HTTP_READ_HEADER_TIMEOUT"`
+	HTTPReadTimeout       time.Duration `mapstructure:"HTTP_READ_TIMEOUT"`
+	HTTPWriteTimeout      time.Duration `mapstructure:"HTTP_WRITE_TIMEOUT"`
+	HTTPIdleTimeout       time.Duration `mapstructure:"HTTP_IDLE_TIMEOUT"`
+	// ShutdownTimeout bounds draining requests and stopping background work
+	// on SIGTERM. For ShutdownDrainDelay of it /readyz already fails while
+	// requests are still served, so load balancers can take the instance out.
+	ShutdownTimeout    time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+	ShutdownDrainDelay time.Duration `mapstructure:"SHUTDOWN_DRAIN_DELAY"`
 }
 
-func Load() (*Config, error) {
+// ErrHelp is returned by Load and LoadServer when the flags asked for the
+// usage.
+var ErrHelp = pflag.ErrHelp
+
+// Load reads the configuration from, in increasing precedence: the defaults,
+// a config file, the environment and the command-line flags. The file is
+// given with --config or CONFIG_FILE and may be an env or YAML file; without
+// either .env is read if it exists. Every setting has a flag named after its
+// variable, e.g. DB_HOST is --db-host.
+//
+// Load only checks the database and logging settings, which is all tools
+// like cmd/apikey need. The server uses LoadServer.
+func Load(args []string) (*Config, error) {
+	v := viper.New()
+
+	fs := pflag.NewFlagSet("songlibrary", pflag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "env or YAML config file")
+	for _, key := range keys() {
+		fs.String(flagName(key), "", "sets "+key)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	for _, key := range keys() {
+		if err := v.BindPFlag(key, fs.Lookup(flagName(key))); err != nil {
+			return nil, err
+		}
+	}
+
+	v.SetDefault("PORT", 8080)
+	v.SetDefault("DB_PORT", 5432)
+	v.SetDefault("DB_MAX_OPEN_CONNS", 25)
+	v.SetDefault("DB_MAX_IDLE_CONNS", 10)
+	v.SetDefault("DB_CONN_MAX_LIFETIME", 30*time.Minute)
+	v.SetDefault("DB_CONN_MAX_IDLE_TIME", 5*time.Minute)
+	v.SetDefault("DB_CONNECT_TIMEOUT", 5*time.Second)
+	v.SetDefault("LOG_LEVEL", "debug")
+	v.SetDefault("LOG_FORMAT", "json")
+	v.SetDefault("API_PROVIDERS_FILE", "")
+	v.SetDefault("API_TIMEOUT", 10*time.Second)
+	v.SetDefault("API_MAX_RETRIES", 3)
+	v.SetDefault("API_RETRY_BASE_DELAY", 200*time.Millisecond)
+	v.SetDefault("API_RETRY_MAX_DELAY", 5*time.Second)
+	v.SetDefault("API_VCR_MODE", "off")
+	v.SetDefault("API_VCR_DIR", "fixtures/cassettes")
+	v.SetDefault("BREAKER_FAILURE_RATE", 0.5)
+	v.SetDefault("BREAKER_WINDOW_SIZE", 20)
+	v.SetDefault("BREAKER_MIN_REQUESTS", 10)
+	v.SetDefault("BREAKER_COOL_DOWN", 30*time.Second)
+	v.SetDefault("BREAKER_HALF_OPEN_REQUESTS", 1)
+	v.SetDefault("CACHE_SIZE", 1000)
+	v.SetDefault("CACHE_TTL", time.Hour)
+	v.SetDefault("CACHE_NEGATIVE_TTL", 5*time.Minute)
+	v.SetDefault("ENRICH_WORKERS", 4)
+	v.SetDefault("ENRICH_MAX_ATTEMPTS", 5)
+	v.SetDefault("ENRICH_RETRY_DELAY", 30*time.Second)
+	v.SetDefault("ENRICH_MAX_RETRY_DELAY", time.Hour)
+	v.SetDefault("ENRICH_POLL_INTERVAL", time.Second)
+	v.SetDefault("ENRICH_LEASE", 2*time.Minute)
+	v.SetDefault("SYNC_INTERVAL", 6*time.Hour)
+	v.SetDefault("SYNC_RATE", 1.0)
+	v.SetDefault("SYNC_BATCH_SIZE", 100)
+	v.SetDefault("WEBHOOK_WORKERS", 2)
+	v.SetDefault("WEBHOOK_MAX_ATTEMPTS", 8)
+	v.SetDefault("WEBHOOK_TIMEOUT", 10*time.Second)
+	v.SetDefault("WEBHOOK_POLL_INTERVAL", time.Second)
+	v.SetDefault("WEBHOOK_RETRY_DELAY", 10*time.Second)
+	v.SetDefault("WEBHOOK_MAX_RETRY_DELAY", time.Hour)
+	v.SetDefault("WEBHOOK_ALLOW_PRIVATE_TARGETS", false)
+	v.SetDefault("OUTBOX_POLL_INTERVAL", 500*time.Millisecond)
+	v.SetDefault("OUTBOX_BATCH_SIZE", 100)
+	v.SetDefault("OUTBOX_RETENTION", 7*24*time.Hour)
+	v.SetDefault("OUTBOX_NOTIFY_CHANNEL", "song_events")
+	v.SetDefault("FEED_RETAIN", 1000)
+	v.SetDefault("FEED_CLIENT_BUFFER", 64)
+	v.SetDefault("AUTH_ENABLED", true)
+	v.SetDefault("JWT_SECRET", "")
+	v.SetDefault("JWT_SECRET_FILE", "")
+	v.SetDefault("JWT_ISSUER", "songlibrary")
+	v.SetDefault("ACCESS_TOKEN_TTL", 15*time.Minute)
+	v.SetDefault("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	v.SetDefault("AUTH_REGISTRATION", false)
+	v.SetDefault("RATE_LIMIT_BACKEND", "memory")
+	v.SetDefault("RATE_LIMIT_READ_RATE", 10.0)
+	v.SetDefault("RATE_LIMIT_READ_BURST", 50)
+	v.SetDefault("RATE_LIMIT_WRITE_RATE", 1.0)
+	v.SetDefault("RATE_LIMIT_WRITE_BURST", 20)
+	v.SetDefault("RATE_LIMIT_UPSTREAM_RATE", 0.2)
+	v.SetDefault("RATE_LIMIT_UPSTREAM_BURST", 5)
+	v.SetDefault("TRUST_PROXY", false)
+	v.SetDefault("TRUST_PROXY_HOPS", 1)
+	v.SetDefault("TRACING_EXPORTER", "none")
+	v.SetDefault("TRACING_ENDPOINT", "")
+	v.SetDefault("TRACING_SAMPLE_RATE", 1.0)
+	v.SetDefault("HEALTH_CHECK_TIMEOUT", 2*time.Second)
+	v.SetDefault("HEALTH_CHECK_PROVIDERS", false)
+	v.SetDefault("HTTP_READ_HEADER_TIMEOUT", 5*time.Second)
+	v.SetDefault("HTTP_READ_TIMEOUT", 15*time.Second)
+	v.SetDefault("HTTP_WRITE_TIMEOUT", 60*time.Second)
+	v.SetDefault("HTTP_IDLE_TIMEOUT", 120*time.Second)
+	v.SetDefault("SHUTDOWN_TIMEOUT", 30*time.Second)
+	v.SetDefault("SHUTDOWN_DRAIN_DELAY", 5*time.Second)
+
+	v.AutomaticEnv()
+
+	if err := readConfigFile(v, *configFile); err != nil {
+		return nil, err
+	}
+
 	config := &Config{}
+	if err := v.Unmarshal(config); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
 
-	viper.SetConfigName(".env")
-	viper.SetConfigType("env")
-	viper.AddConfigPath(".")
+	var err error
+	if config.DBPassword, err = readSecret("DB_PASSWORD", config.DBPassword, config.DBPasswordFile); err != nil {
+		return nil, err
+	}
+	if config.JWTSecret, err = readSecret("JWT_SECRET", config.JWTSecret, config.JWTSecretFile); err != nil {
+		return nil, err
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
 
-	viper.AutomaticEnv()
+	return config, nil
+}
 
-	err := viper.ReadInConfig()
+// LoadServer reads the configuration like Load and also checks the settings
+// of the server and loads its providers.
+func LoadServer(args []string) (*Config, error) {
+	config, err := Load(args)
 	if err != nil {
-		log.Fatal("Can't find the file .env : ", err)
+		return nil, err
+	}
+
+	if err := config.validateServer(); err != nil {
+		return nil, err
 	}
 
-	err = viper.Unmarshal(&config)
+	config.Providers, err = loadProviders(config.ProvidersFile, config.ExternalAPI)
 	if err != nil {
-		log.Fatal("Environment can't be loaded: ", err)
+		return nil, err
 	}
 
 	return config, nil
 }
+
+// readConfigFile reads the given file, or .env when none is given and it
+// exists. Its type follows the extension: .yaml and .yml are YAML, anything
+// else is an env file.
+func readConfigFile(v *viper.Viper, path string) error {
+	if path == "" {
+		if _, err := os.Stat(".env"); err != nil {
+			return nil
+		}
+		path = ".env"
+	}
+
+	v.SetConfigFile(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		v.SetConfigType("yaml")
+	default:
+		v.SetConfigType("env")
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// readSecret returns the content of file when set, otherwise value. Setting
+// both is a mistake.
+func readSecret(key, value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("set either %s or %s_FILE, not both", key, key)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", key, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// keys lists the variables of all settings.
+func keys() []string {
+	var keys []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("mapstructure"); key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// ProviderConfig describes one song detail provider: where to find it, how to
+// pass the group and song, and where the details are in its response.
+type ProviderConfig struct {
+	Name       string       `json:"name"`
+	BaseURL    string       `json:"base_url"`
+	GroupParam string       `json:"group_param"`
+	SongParam  string       `json:"song_param"`
+	Fields     FieldMapping `json:"fields"`
+	DateFormat string       `json:"date_format"`
+}
+
+// FieldMapping holds dot-separated paths to the detail fields in a provider response.
+type FieldMapping struct {
+	ReleaseDate string `json:"release_date"`
+	Text        string `json:"text"`
+	Link        string `json:"link"`
+}
+
+func loadProviders(path, defaultURL string) ([]ProviderConfig, error) {
+	if path == "" {
+		return []ProviderConfig{{Name: "default", BaseURL: defaultURL}}, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read providers file: %w", err)
+	}
+
+	var providers []ProviderConfig
+	if err := json.Unmarshal(content, &providers); err != nil {
+		return nil, fmt.Errorf("failed to parse providers file: %w", err)
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("providers file %s lists no providers", path)
+	}
+	for i, p := range providers {
+		if p.Name == "" || p.BaseURL == "" {
+			return nil, fmt.Errorf("provider #%d in %s needs a name and a base_url", i+1, path)
+		}
+	}
+
+	return providers, nil
+}
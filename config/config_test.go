@@ -0,0 +1,153 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile creates a file in a temporary directory and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	envFile := writeFile(t, "app.env", "LOG_LEVEL=info\nDB_PORT=6432\n")
+	yamlFile := writeFile(t, "app.yaml", "log_level: info\ndb_port: 6432\n")
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		logLevel string
+		dbPort   int
+	}{
+		{name: "defaults", logLevel: "debug", dbPort: 5432},
+		{name: "env file over defaults", args: []string{"--config", envFile}, logLevel: "info", dbPort: 6432},
+		{name: "yaml file over defaults", args: []string{"--config", yamlFile}, logLevel: "info", dbPort: 6432},
+		{name: "file from CONFIG_FILE", env: map[string]string{"CONFIG_FILE": yamlFile}, logLevel: "info", dbPort: 6432},
+		{name: "environment over file", env: map[string]string{"LOG_LEVEL": "warn"}, args: []string{"--config", envFile}, logLevel: "warn", dbPort: 6432},
+		{name: "flag over environment", env: map[string]string{"LOG_LEVEL": "warn"}, args: []string{"--config", envFile, "--log-level", "error"}, logLevel: "error", dbPort: 6432},
+		{name: "flag over defaults", args: []string{"--db-port=7000"}, logLevel: "debug", dbPort: 7000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_HOST", "db")
+			t.Setenv("DB_NAME", "songs")
+			t.Setenv("DB_USER", "songs")
+			// Empty variables count as unset.
+			for _, key := range []string{"CONFIG_FILE", "LOG_LEVEL", "DB_PORT"} {
+				t.Setenv(key, "")
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load(tt.args)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.LogLevel != tt.logLevel {
+				t.Errorf("LOG_LEVEL = %q, want %q", cfg.LogLevel, tt.logLevel)
+			}
+			if cfg.DBPort != tt.dbPort {
+				t.Errorf("DB_PORT = %d, want %d", cfg.DBPort, tt.dbPort)
+			}
+		})
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	secretFile := writeFile(t, "password", "s3cret\n")
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr string
+	}{
+		{name: "from the environment", env: map[string]string{"DB_PASSWORD": "plain"}, want: "plain"},
+		{name: "from a file", env: map[string]string{"DB_PASSWORD_FILE": secretFile}, want: "s3cret"},
+		{name: "both set", env: map[string]string{"DB_PASSWORD": "plain", "DB_PASSWORD_FILE": secretFile}, wantErr: "either DB_PASSWORD or DB_PASSWORD_FILE"},
+		{name: "missing file", env: map[string]string{"DB_PASSWORD_FILE": secretFile + ".missing"}, wantErr: "failed to read DB_PASSWORD_FILE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_HOST", "db")
+			t.Setenv("DB_NAME", "songs")
+			t.Setenv("DB_USER", "songs")
+			t.Setenv("DB_PASSWORD", "")
+			t.Setenv("DB_PASSWORD_FILE", "")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load(nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.DBPassword != tt.want {
+				t.Errorf("DB_PASSWORD = %q, want %q", cfg.DBPassword, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadServerValidation(t *testing.T) {
+	t.Setenv("DB_HOST", "db")
+	t.Setenv("DB_NAME", "songs")
+	t.Setenv("DB_USER", "songs")
+	t.Setenv("API_URL", "")
+	t.Setenv("JWT_SECRET", "")
+
+	// Tools do not need the server settings.
+	if _, err := Load(nil); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	_, err := LoadServer([]string{"--cache-size", "0", "--enrich-workers=-1"})
+	if err == nil {
+		t.Fatal("LoadServer accepted an invalid configuration")
+	}
+	for _, want := range []string{"API_URL or API_PROVIDERS_FILE is required", "JWT_SECRET or JWT_SECRET_FILE", "CACHE_SIZE", "ENRICH_WORKERS"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q: %v", want, err)
+		}
+	}
+
+	t.Setenv("API_URL", "http://localhost:8081/info")
+	t.Setenv("JWT_SECRET", "secret")
+	if _, err := LoadServer(nil); err == nil || !strings.Contains(err.Error(), "JWT_SECRET must be at least 32 bytes") {
+		t.Errorf("short JWT_SECRET: err = %v", err)
+	}
+
+	t.Setenv("JWT_SECRET", strings.Repeat("s", 32))
+	cfg, err := LoadServer(nil)
+	if err != nil {
+		t.Fatalf("LoadServer: %v", err)
+	}
+	if len(cfg.Providers) != 1 || cfg.Providers[0].BaseURL != "http://localhost:8081/info" {
+		t.Errorf("providers = %+v", cfg.Providers)
+	}
+}
+
+func TestLoadHelp(t *testing.T) {
+	if _, err := Load([]string{"--help"}); !errors.Is(err, ErrHelp) {
+		t.Errorf("err = %v, want ErrHelp", err)
+	}
+}
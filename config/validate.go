@@ -0,0 +1,137 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// minJWTSecretLength is the shortest JWT secret accepted, the size of the
+// HMAC-SHA256 output. Shorter secrets can be guessed offline from one token.
+const minJWTSecretLength = 32
+
+// checks collects every failed check, so all of them are reported at once.
+type checks []error
+
+func (c *checks) check(ok bool, format string, args ...interface{}) {
+	if !ok {
+		*c = append(*c, fmt.Errorf(format, args...))
+	}
+}
+
+func (c *checks) oneOf(key, value string, allowed ...string) {
+	c.check(slices.Contains(allowed, value), "%s must be one of %v, got %q", key, allowed, value)
+}
+
+func (c *checks) positive(key string, d time.Duration) {
+	c.check(d > 0, "%s must be positive, got %s", key, d)
+}
+
+func (c *checks) count(key string, n int) {
+	c.check(n > 0, "%s must be positive, got %d", key, n)
+}
+
+func (c *checks) err() error {
+	if len(*c) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(*c...))
+	}
+	return nil
+}
+
+// validate checks the settings every command needs: the database and logging.
+func (c *Config) validate() error {
+	var errs checks
+
+	errs.check(c.DBHost != "", "DB_HOST is required")
+	errs.check(c.DBPort > 0 && c.DBPort <= 65535, "DB_PORT must be between 1 and 65535, got %d", c.DBPort)
+	errs.check(c.DBName != "", "DB_NAME is required")
+	errs.check(c.DBUser != "", "DB_USER is required")
+	errs.check(c.DBMaxOpenConns >= 0, "DB_MAX_OPEN_CONNS must not be negative, got %d", c.DBMaxOpenConns)
+	errs.check(c.DBMaxIdleConns >= 0, "DB_MAX_IDLE_CONNS must not be negative, got %d", c.DBMaxIdleConns)
+	errs.positive("DB_CONNECT_TIMEOUT", c.DBConnectTimeout)
+
+	var level slog.Level
+	errs.check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel)
+	errs.oneOf("LOG_FORMAT", c.LogFormat, "json", "text")
+
+	return errs.err()
+}
+
+// validateServer checks the settings only the server uses.
+func (c *Config) validateServer() error {
+	var errs checks
+
+	errs.check(c.Port > 0 && c.Port <= 65535, "PORT must be between 1 and 65535, got %d", c.Port)
+	errs.check(c.ExternalAPI != "" || c.ProvidersFile != "", "API_URL or API_PROVIDERS_FILE is required")
+
+	errs.positive("API_TIMEOUT", c.APITimeout)
+	errs.check(c.APIMaxRetries >= 0, "API_MAX_RETRIES must not be negative, got %d", c.APIMaxRetries)
+	errs.positive("API_RETRY_BASE_DELAY", c.APIRetryBaseDelay)
+	errs.check(c.APIRetryMaxDelay >= c.APIRetryBaseDelay, "API_RETRY_MAX_DELAY must be at least API_RETRY_BASE_DELAY, got %s", c.APIRetryMaxDelay)
+	errs.oneOf("API_VCR_MODE", c.APIVCRMode, "off", "record", "replay")
+
+	errs.check(c.BreakerFailureRate > 0 && c.BreakerFailureRate <= 1, "BREAKER_FAILURE_RATE must be above 0 and at most 1, got %g", c.BreakerFailureRate)
+	errs.count("BREAKER_WINDOW_SIZE", c.BreakerWindowSize)
+	errs.check(c.BreakerMinRequests > 0 && c.BreakerMinRequests <= c.BreakerWindowSize,
+		"BREAKER_MIN_REQUESTS must be between 1 and BREAKER_WINDOW_SIZE, got %d", c.BreakerMinRequests)
+	errs.positive("BREAKER_COOL_DOWN", c.BreakerCoolDown)
+	errs.count("BREAKER_HALF_OPEN_REQUESTS", c.BreakerHalfOpenRequests)
+
+	errs.count("CACHE_SIZE", c.CacheSize)
+	errs.positive("CACHE_TTL", c.CacheTTL)
+	errs.check(c.CacheNegativeTTL >= 0, "CACHE_NEGATIVE_TTL must not be negative, got %s", c.CacheNegativeTTL)
+
+	errs.count("ENRICH_WORKERS", c.EnrichWorkers)
+	errs.count("ENRICH_MAX_ATTEMPTS", c.EnrichMaxAttempts)
+	errs.positive("ENRICH_RETRY_DELAY", c.EnrichRetryDelay)
+	errs.check(c.EnrichMaxRetryDelay >= c.EnrichRetryDelay, "ENRICH_MAX_RETRY_DELAY must be at least ENRICH_RETRY_DELAY, got %s", c.EnrichMaxRetryDelay)
+	errs.positive("ENRICH_POLL_INTERVAL", c.EnrichPollInterval)
+	errs.positive("ENRICH_LEASE", c.EnrichLease)
+
+	errs.check(c.SyncRate > 0, "SYNC_RATE must be positive, got %g", c.SyncRate)
+	errs.check(c.SyncInterval >= 0, "SYNC_INTERVAL must not be negative, got %s", c.SyncInterval)
+	errs.count("SYNC_BATCH_SIZE", c.SyncBatchSize)
+
+	errs.count("WEBHOOK_WORKERS", c.WebhookWorkers)
+	errs.count("WEBHOOK_MAX_ATTEMPTS", c.WebhookMaxAttempts)
+	errs.positive("WEBHOOK_TIMEOUT", c.WebhookTimeout)
+	errs.positive("WEBHOOK_POLL_INTERVAL", c.WebhookPollInterval)
+	errs.positive("WEBHOOK_RETRY_DELAY", c.WebhookRetryDelay)
+	errs.check(c.WebhookMaxRetryDelay >= c.WebhookRetryDelay, "WEBHOOK_MAX_RETRY_DELAY must be at least WEBHOOK_RETRY_DELAY, got %s", c.WebhookMaxRetryDelay)
+
+	errs.positive("OUTBOX_POLL_INTERVAL", c.OutboxPollInterval)
+	errs.count("OUTBOX_BATCH_SIZE", c.OutboxBatchSize)
+	errs.positive("OUTBOX_RETENTION", c.OutboxRetention)
+	errs.count("FEED_RETAIN", c.FeedRetain)
+	errs.count("FEED_CLIENT_BUFFER", c.FeedClientBuffer)
+
+	// A rate of zero lifts the limit, a positive one needs a bucket to fill.
+	errs.oneOf("RATE_LIMIT_BACKEND", c.RateLimitBackend, "off", "memory", "postgres")
+	errs.check(c.RateLimitReadRate >= 0, "RATE_LIMIT_READ_RATE must not be negative, got %g", c.RateLimitReadRate)
+	errs.check(c.RateLimitReadRate == 0 || c.RateLimitReadBurst > 0, "RATE_LIMIT_READ_BURST must be positive, got %d", c.RateLimitReadBurst)
+	errs.check(c.RateLimitWriteRate >= 0, "RATE_LIMIT_WRITE_RATE must not be negative, got %g", c.RateLimitWriteRate)
+	errs.check(c.RateLimitWriteRate == 0 || c.RateLimitWriteBurst > 0, "RATE_LIMIT_WRITE_BURST must be positive, got %d", c.RateLimitWriteBurst)
+	errs.check(c.RateLimitUpstreamRate >= 0, "RATE_LIMIT_UPSTREAM_RATE must not be negative, got %g", c.RateLimitUpstreamRate)
+	errs.check(c.RateLimitUpstreamRate == 0 || c.RateLimitUpstreamBurst > 0, "RATE_LIMIT_UPSTREAM_BURST must be positive, got %d", c.RateLimitUpstreamBurst)
+	errs.check(!c.TrustProxy || c.TrustProxyHops > 0, "TRUST_PROXY_HOPS must be positive, got %d", c.TrustProxyHops)
+
+	errs.oneOf("TRACING_EXPORTER", c.TracingExporter, "none", "stdout", "otlp")
+	errs.check(c.TracingSampleRate >= 0 && c.TracingSampleRate <= 1, "TRACING_SAMPLE_RATE must be between 0 and 1, got %g", c.TracingSampleRate)
+
+	errs.check(!c.AuthEnabled || c.JWTSecret != "", "JWT_SECRET or JWT_SECRET_FILE is required with AUTH_ENABLED=true")
+	errs.check(!c.AuthEnabled || c.JWTSecret == "" || len(c.JWTSecret) >= minJWTSecretLength, "JWT_SECRET must be at least %d bytes long, got %d", minJWTSecretLength, len(c.JWTSecret))
+	errs.positive("ACCESS_TOKEN_TTL", c.AccessTokenTTL)
+	errs.positive("REFRESH_TOKEN_TTL", c.RefreshTokenTTL)
+	errs.positive("HEALTH_CHECK_TIMEOUT", c.HealthCheckTimeout)
+	errs.positive("HTTP_READ_HEADER_TIMEOUT", c.HTTPReadHeaderTimeout)
+	errs.positive("HTTP_READ_TIMEOUT", c.HTTPReadTimeout)
+	errs.positive("HTTP_WRITE_TIMEOUT", c.HTTPWriteTimeout)
+	errs.positive("HTTP_IDLE_TIMEOUT", c.HTTPIdleTimeout)
+	errs.positive("SHUTDOWN_TIMEOUT", c.ShutdownTimeout)
+	errs.check(c.ShutdownDrainDelay >= 0 && c.ShutdownDrainDelay < c.ShutdownTimeout,
+		"SHUTDOWN_DRAIN_DELAY must be at least 0 and below SHUTDOWN_TIMEOUT, got %s", c.ShutdownDrainDelay)
+
+	return errs.err()
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+type (
+	SongDetailFetcher interface {
+		FetchSongDetail(ctx context.Context, group, song string) (*models.SongDetail, error)
+	}
+
+	BreakerConfig struct {
+		// FailureRate opens the circuit once this share of the last WindowSize
+		// calls failed, provided at least MinRequests calls were made.
+		FailureRate float64
+		WindowSize  int
+		MinRequests int
+		// CoolDown is how long the circuit stays open before trial calls are let through.
+		CoolDown time.Duration
+		// HalfOpenRequests successful trial calls close the circuit again.
+		HalfOpenRequests int
+	}
+
+	// CircuitBreaker stops calling a failing provider for a while so callers
+	// fail fast instead of waiting for timeouts.
+	CircuitBreaker struct {
+		name string
+		next SongDetailFetcher
+		cfg  BreakerConfig
+		now  func() time.Time
+
+		mu        sync.Mutex
+		state     string
+		window    []bool
+		pos       int
+		count     int
+		failures  int
+		openedAt  time.Time
+		inFlight  int
+		successes int
+	}
+)
+
+func NewCircuitBreaker(name string, next SongDetailFetcher, cfg BreakerConfig) *CircuitBreaker {
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = 20
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = cfg.WindowSize / 2
+	}
+	if cfg.FailureRate <= 0 || cfg.FailureRate > 1 {
+		cfg.FailureRate = 0.5
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+
+	return &CircuitBreaker{
+		name:   name,
+		next:   next,
+		cfg:    cfg,
+		now:    time.Now,
+		state:  StateClosed,
+		window: make([]bool, cfg.WindowSize),
+	}
+}
+
+func (b *CircuitBreaker) FetchSongDetail(ctx context.Context, group, song string) (*models.SongDetail, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	songDetail, err := b.next.FetchSongDetail(ctx, group, song)
+
+	// The caller giving up says nothing about the provider's health.
+	if ctx.Err() != nil {
+		b.release()
+		return songDetail, err
+	}
+
+	b.record(!isProviderFailure(err))
+	return songDetail, err
+}
+
+// Status returns a snapshot of the breaker for monitoring.
+func (b *CircuitBreaker) Status() models.BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+
+	status := models.BreakerStatus{
+		Name:     b.name,
+		State:    b.state,
+		Requests: b.count,
+		Failures: b.failures,
+	}
+	if b.count > 0 {
+		status.FailureRate = float64(b.failures) / float64(b.count)
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		retryAt := openedAt.Add(b.cfg.CoolDown)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+	return status
+}
+
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+
+	switch b.state {
+	case StateOpen:
+		return apperrors.UpstreamUnavailable("circuit_open", "song details provider %s is temporarily unavailable", b.name)
+	case StateHalfOpen:
+		if b.inFlight >= b.cfg.HalfOpenRequests {
+			return apperrors.UpstreamUnavailable("circuit_open", "song details provider %s is temporarily unavailable", b.name)
+		}
+		b.inFlight++
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen && b.inFlight > 0 {
+		b.inFlight--
+	}
+}
+
+func (b *CircuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateHalfOpen:
+		if b.inFlight > 0 {
+			b.inFlight--
+		}
+		if !success {
+			b.transition(StateOpen)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.transition(StateClosed)
+		}
+	case StateClosed:
+		if b.count == len(b.window) && !b.window[b.pos] {
+			b.failures--
+		}
+		b.window[b.pos] = success
+		b.pos = (b.pos + 1) % len(b.window)
+		if b.count < len(b.window) {
+			b.count++
+		}
+		if !success {
+			b.failures++
+		}
+
+		if b.count >= b.cfg.MinRequests && float64(b.failures)/float64(b.count) >= b.cfg.FailureRate {
+			b.transition(StateOpen)
+		}
+	}
+}
+
+// refresh moves an open circuit to half-open once the cool-down has passed.
+func (b *CircuitBreaker) refresh() {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cfg.CoolDown {
+		b.transition(StateHalfOpen)
+	}
+}
+
+func (b *CircuitBreaker) transition(state string) {
+	slog.Warn("Circuit breaker state changed", slog.String("breaker", b.name), slog.String("from", b.state), slog.String("to", state))
+
+	b.state = state
+	b.inFlight = 0
+	b.successes = 0
+
+	switch state {
+	case StateOpen:
+		b.openedAt = b.now()
+	case StateClosed:
+		b.pos, b.count, b.failures = 0, 0, 0
+	}
+}
+
+// isProviderFailure tells apart errors caused by an unhealthy provider from
+// regular answers such as "not found". A request missing from a replayed
+// cassette says nothing about the provider.
+func isProviderFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrNoInteraction) {
+		return false
+	}
+	_, ok := apperrors.As(err)
+	return !ok || errors.Is(err, apperrors.ErrUpstreamUnavailable)
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type fetcherFunc func(ctx context.Context, group, song string) (*models.SongDetail, error)
+
+func (f fetcherFunc) FetchSongDetail(ctx context.Context, group, song string) (*models.SongDetail, error) {
+	return f(ctx, group, song)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		errDown     = errors.New("connection refused")
+		errNotFound = apperrors.NotFound("song_detail_not_found", "no details")
+		errReplay   = toAppError(ErrNoInteraction, "group", "song")
+	)
+
+	cfg := BreakerConfig{FailureRate: 0.5, WindowSize: 4, MinRequests: 2, CoolDown: time.Minute, HalfOpenRequests: 1}
+
+	// A step makes one call after advancing the clock. The provider answers
+	// with result; rejected calls never reach it.
+	type step struct {
+		advance  time.Duration
+		result   error
+		rejected bool
+		state    string
+	}
+
+	tests := []struct {
+		name  string
+		cfg   BreakerConfig
+		steps []step
+	}{
+		{
+			name: "stays closed below min requests",
+			cfg:  cfg,
+			steps: []step{
+				{result: errDown, state: StateClosed},
+			},
+		},
+		{
+			name: "opens at the failure rate",
+			cfg:  cfg,
+			steps: []step{
+				{result: nil, state: StateClosed},
+				{result: errDown, state: StateOpen},
+				{rejected: true, state: StateOpen},
+			},
+		},
+		{
+			name: "regular errors are no failures",
+			cfg:  cfg,
+			steps: []step{
+				{result: errNotFound, state: StateClosed},
+				{result: errNotFound, state: StateClosed},
+				{result: errNotFound, state: StateClosed},
+			},
+		},
+		{
+			name: "unmatched replayed requests are no failures",
+			cfg:  cfg,
+			steps: []step{
+				{result: errReplay, state: StateClosed},
+				{result: errReplay, state: StateClosed},
+				{result: errReplay, state: StateClosed},
+			},
+		},
+		{
+			name: "old failures leave the window",
+			cfg:  BreakerConfig{FailureRate: 0.75, WindowSize: 4, MinRequests: 4, CoolDown: time.Minute, HalfOpenRequests: 1},
+			steps: []step{
+				{result: errDown, state: StateClosed},
+				{result: errDown, state: StateClosed},
+				{result: nil, state: StateClosed},
+				{result: nil, state: StateClosed},
+				{result: errDown, state: StateClosed},
+				{result: nil, state: StateClosed},
+			},
+		},
+		{
+			name: "half-open after the cool-down, closes on success",
+			cfg:  cfg,
+			steps: []step{
+				{result: errDown, state: StateClosed},
+				{result: errDown, state: StateOpen},
+				{advance: 30 * time.Second, rejected: true, state: StateOpen},
+				{advance: 30 * time.Second, result: nil, state: StateClosed},
+				{result: errDown, state: StateClosed},
+			},
+		},
+		{
+			name: "half-open reopens on failure",
+			cfg:  cfg,
+			steps: []step{
+				{result: errDown, state: StateClosed},
+				{result: errDown, state: StateOpen},
+				{advance: time.Minute, result: errDown, state: StateOpen},
+				{rejected: true, state: StateOpen},
+			},
+		},
+		{
+			name: "several trial calls needed",
+			cfg:  BreakerConfig{FailureRate: 0.5, WindowSize: 4, MinRequests: 2, CoolDown: time.Minute, HalfOpenRequests: 2},
+			steps: []step{
+				{result: errDown, state: StateClosed},
+				{result: errDown, state: StateOpen},
+				{advance: time.Minute, result: nil, state: StateHalfOpen},
+				{result: nil, state: StateClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			var result error
+			calls := 0
+			next := fetcherFunc(func(ctx context.Context, group, song string) (*models.SongDetail, error) {
+				calls++
+				return nil, result
+			})
+
+			b := NewCircuitBreaker("test", next, tt.cfg)
+			b.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				result = s.result
+				before := calls
+
+				_, err := b.FetchSongDetail(context.Background(), "group", "song")
+
+				rejected := calls == before
+				if rejected != s.rejected {
+					t.Fatalf("step %d: rejected = %v, want %v", i, rejected, s.rejected)
+				}
+				if rejected && !errors.Is(err, apperrors.ErrUpstreamUnavailable) {
+					t.Fatalf("step %d: rejected with %v, want upstream unavailable", i, err)
+				}
+				if state := b.Status().State; state != s.state {
+					t.Fatalf("step %d: state = %s, want %s", i, state, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenLimitsTrialCalls(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fail := true
+	next := fetcherFunc(func(ctx context.Context, group, song string) (*models.SongDetail, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		started <- struct{}{}
+		<-release
+		return &models.SongDetail{}, nil
+	})
+
+	b := NewCircuitBreaker("test", next, BreakerConfig{FailureRate: 0.5, WindowSize: 2, MinRequests: 1, CoolDown: time.Minute, HalfOpenRequests: 1})
+	b.now = func() time.Time { return now }
+
+	b.FetchSongDetail(context.Background(), "group", "song")
+	if state := b.Status().State; state != StateOpen {
+		t.Fatalf("state = %s, want %s", state, StateOpen)
+	}
+
+	now = now.Add(time.Minute)
+	fail = false
+	done := make(chan error)
+	go func() {
+		_, err := b.FetchSongDetail(context.Background(), "group", "song")
+		done <- err
+	}()
+	<-started
+
+	if _, err := b.FetchSongDetail(context.Background(), "group", "song"); !errors.Is(err, apperrors.ErrUpstreamUnavailable) {
+		t.Errorf("second trial call: err = %v, want upstream unavailable", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("trial call: %v", err)
+	}
+	if state := b.Status().State; state != StateClosed {
+		t.Errorf("state = %s, want %s", state, StateClosed)
+	}
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	CacheConfig struct {
+		Size int
+		TTL  time.Duration
+		// NegativeTTL is how long "not found" answers are remembered, zero disables it.
+		NegativeTTL time.Duration
+		// FetchTimeout bounds an upstream lookup with all its retries, see FetchBudget.
+		FetchTimeout time.Duration
+	}
+
+	// CachedFetcher remembers song details by (group, song) and collapses
+	// concurrent identical lookups into one upstream call.
+	CachedFetcher struct {
+		name string
+		next SongDetailFetcher
+		cfg  CacheConfig
+		now  func() time.Time
+
+		mu       sync.Mutex
+		entries  map[string]*list.Element
+		lru      *list.List
+		inflight map[string]*fetchCall
+
+		hits         int64
+		negativeHits int64
+		misses       int64
+		shared       int64
+		evictions    int64
+	}
+
+	cacheEntry struct {
+		key       string
+		detail    *models.SongDetail
+		err       error
+		expiresAt time.Time
+	}
+
+	fetchCall struct {
+		done   chan struct{}
+		detail *models.SongDetail
+		err    error
+	}
+)
+
+func NewCachedFetcher(name string, next SongDetailFetcher, cfg CacheConfig) *CachedFetcher {
+	if cfg.Size <= 0 {
+		cfg.Size = 1000
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Hour
+	}
+	if cfg.FetchTimeout <= 0 {
+		cfg.FetchTimeout = time.Minute
+	}
+
+	return &CachedFetcher{
+		name:     name,
+		next:     next,
+		cfg:      cfg,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*fetchCall),
+	}
+}
+
+func (c *CachedFetcher) FetchSongDetail(ctx context.Context, group, song string) (*models.SongDetail, error) {
+	key := cacheKey(group, song)
+
+	c.mu.Lock()
+	if entry, ok := c.lookup(key); ok {
+		if entry.err != nil {
+			c.negativeHits++
+		} else {
+			c.hits++
+		}
+		c.mu.Unlock()
+		return copyDetail(entry.detail), entry.err
+	}
+
+	call, ok := c.inflight[key]
+	if ok {
+		c.shared++
+	} else {
+		c.misses++
+		call = &fetchCall{done: make(chan struct{})}
+		c.inflight[key] = call
+		// The upstream call outlives a caller that gives up, so callers
+		// waiting on the same key still get the answer, but not a hung provider.
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.cfg.FetchTimeout)
+		go func() {
+			defer cancel()
+			c.fetch(fetchCtx, key, group, song, call)
+		}()
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, apperrors.UpstreamUnavailable("upstream_unavailable", "song details lookup was cancelled").Wrap(ctx.Err())
+	case <-call.done:
+		return copyDetail(call.detail), call.err
+	}
+}
+
+func (c *CachedFetcher) fetch(ctx context.Context, key, group, song string, call *fetchCall) {
+	call.detail, call.err = c.next.FetchSongDetail(ctx, group, song)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	switch {
+	case call.err == nil:
+		c.store(key, call.detail, nil, c.cfg.TTL)
+	case c.cfg.NegativeTTL > 0 && errors.Is(call.err, apperrors.ErrNotFound):
+		c.store(key, nil, call.err, c.cfg.NegativeTTL)
+	}
+	c.mu.Unlock()
+
+	close(call.done)
+}
+
+// Stats returns the cache counters for monitoring.
+func (c *CachedFetcher) Stats() models.CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return models.CacheStats{
+		Name:         c.name,
+		Entries:      c.lru.Len(),
+		Capacity:     c.cfg.Size,
+		Hits:         c.hits,
+		NegativeHits: c.negativeHits,
+		Misses:       c.misses,
+		Shared:       c.shared,
+		Evictions:    c.evictions,
+	}
+}
+
+func (c *CachedFetcher) lookup(key string) (*cacheEntry, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+func (c *CachedFetcher) store(key string, detail *models.SongDetail, err error, ttl time.Duration) {
+	entry := &cacheEntry{
+		key:       key,
+		detail:    copyDetail(detail),
+		err:       err,
+		expiresAt: c.now().Add(ttl),
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.cfg.Size {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+func (c *CachedFetcher) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+func cacheKey(group, song string) string {
+	return strings.ToLower(strings.TrimSpace(group)) + "\x00" + strings.ToLower(strings.TrimSpace(song))
+}
+
+func copyDetail(detail *models.SongDetail) *models.SongDetail {
+	if detail == nil {
+		return nil
+	}
+	cp := *detail
+	return &cp
+}
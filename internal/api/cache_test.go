@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+func TestCachedFetcher(t *testing.T) {
+	errNotFound := apperrors.NotFound("song_detail_not_found", "no details")
+	errDown := apperrors.UpstreamUnavailable("upstream_unavailable", "provider is down")
+
+	// A step looks up song after advancing the clock; the provider answers
+	// with result and hit tells whether it was asked at all.
+	type step struct {
+		advance time.Duration
+		song    string
+		result  error
+		hit     bool
+	}
+
+	tests := []struct {
+		name  string
+		cfg   CacheConfig
+		steps []step
+		stats models.CacheStats
+	}{
+		{
+			name: "hit within the TTL",
+			cfg:  CacheConfig{Size: 10, TTL: time.Minute},
+			steps: []step{
+				{song: "a"},
+				{advance: 59 * time.Second, song: "a", hit: true},
+				{song: "A ", hit: true},
+			},
+			stats: models.CacheStats{Entries: 1, Hits: 2, Misses: 1},
+		},
+		{
+			name: "expired after the TTL",
+			cfg:  CacheConfig{Size: 10, TTL: time.Minute},
+			steps: []step{
+				{song: "a"},
+				{advance: time.Minute, song: "a"},
+			},
+			stats: models.CacheStats{Entries: 1, Misses: 2},
+		},
+		{
+			name: "least recently used is evicted",
+			cfg:  CacheConfig{Size: 2, TTL: time.Minute},
+			steps: []step{
+				{song: "a"},
+				{song: "b"},
+				{song: "a", hit: true},
+				{song: "c"},
+				{song: "a", hit: true},
+				{song: "b"},
+			},
+			stats: models.CacheStats{Entries: 2, Hits: 2, Misses: 4, Evictions: 2},
+		},
+		{
+			name: "not found is remembered for the negative TTL",
+			cfg:  CacheConfig{Size: 10, TTL: time.Hour, NegativeTTL: time.Minute},
+			steps: []step{
+				{song: "a", result: errNotFound},
+				{advance: 30 * time.Second, song: "a", result: errNotFound, hit: true},
+				{advance: 30 * time.Second, song: "a", result: errNotFound},
+			},
+			stats: models.CacheStats{Entries: 1, NegativeHits: 1, Misses: 2},
+		},
+		{
+			name: "not found is not remembered without a negative TTL",
+			cfg:  CacheConfig{Size: 10, TTL: time.Hour},
+			steps: []step{
+				{song: "a", result: errNotFound},
+				{song: "a", result: errNotFound},
+			},
+			stats: models.CacheStats{Misses: 2},
+		},
+		{
+			name: "other errors are never remembered",
+			cfg:  CacheConfig{Size: 10, TTL: time.Hour, NegativeTTL: time.Minute},
+			steps: []step{
+				{song: "a", result: errDown},
+				{song: "a", result: errDown},
+			},
+			stats: models.CacheStats{Misses: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			var result error
+			calls := 0
+			next := fetcherFunc(func(ctx context.Context, group, song string) (*models.SongDetail, error) {
+				calls++
+				if result != nil {
+					return nil, result
+				}
+				return &models.SongDetail{Text: song}, nil
+			})
+
+			c := NewCachedFetcher("test", next, tt.cfg)
+			c.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				result = s.result
+				before := calls
+
+				detail, err := c.FetchSongDetail(context.Background(), "group", s.song)
+
+				if hit := calls == before; hit != s.hit {
+					t.Fatalf("step %d: hit = %v, want %v", i, hit, s.hit)
+				}
+				if !errors.Is(err, s.result) {
+					t.Fatalf("step %d: err = %v, want %v", i, err, s.result)
+				}
+				if err == nil && detail.Text == "" {
+					t.Fatalf("step %d: empty detail", i)
+				}
+			}
+
+			stats := c.Stats()
+			tt.stats.Name, tt.stats.Capacity = "test", tt.cfg.Size
+			if stats != tt.stats {
+				t.Errorf("stats = %+v, want %+v", stats, tt.stats)
+			}
+		})
+	}
+}
+
+func TestCachedFetcherSharesLookups(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	next := fetcherFunc(func(ctx context.Context, group, song string) (*models.SongDetail, error) {
+		calls.Add(1)
+		<-release
+		return &models.SongDetail{Text: "lyrics"}, nil
+	})
+	c := NewCachedFetcher("test", next, CacheConfig{})
+
+	const callers = 5
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if detail, err := c.FetchSongDetail(context.Background(), "Muse", "Uprising"); err != nil || detail.Text != "lyrics" {
+				t.Errorf("detail = %v, err = %v", detail, err)
+			}
+		}()
+	}
+
+	// Let every caller join the lookup before it finishes.
+	for {
+		stats := c.Stats()
+		if stats.Misses+stats.Shared == callers {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("provider called %d times, want once", calls.Load())
+	}
+}
+
+func TestCachedFetcherOutlivesCaller(t *testing.T) {
+	release := make(chan struct{})
+	next := fetcherFunc(func(ctx context.Context, group, song string) (*models.SongDetail, error) {
+		<-release
+		return &models.SongDetail{Text: "lyrics"}, ctx.Err()
+	})
+	c := NewCachedFetcher("test", next, CacheConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.FetchSongDetail(ctx, "Muse", "Uprising"); !errors.Is(err, apperrors.ErrUpstreamUnavailable) {
+		t.Fatalf("cancelled caller: err = %v", err)
+	}
+
+	close(release)
+	// The lookup still finishes and fills the cache for the next caller.
+	if detail, err := c.FetchSongDetail(context.Background(), "Muse", "Uprising"); err != nil || detail.Text != "lyrics" {
+		t.Errorf("detail = %v, err = %v", detail, err)
+	}
+}
@@ -3,46 +3,189 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/metrics"
 	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/KarmaBeLike/SongLibrary/internal/tracing"
+	"github.com/KarmaBeLike/SongLibrary/pkg/releasedate"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type ExternalAPI struct {
-	baseURL string
-	client  *http.Client
-}
+type (
+	Config struct {
+		Name    string
+		BaseURL string
+		// GroupParam and SongParam name the query parameters, "group" and "song" by default.
+		GroupParam string
+		SongParam  string
+		Fields     FieldMapping
+		// DateFormat is the Go layout of the provider's release dates. If empty,
+		// the formats understood by releasedate.Parse are expected.
+		DateFormat string
+		// Timeout limits a single attempt, retries are bounded by the request context.
+		Timeout time.Duration
+		Retry   RetryPolicy
+		// Transport replaces the default HTTP transport, e.g. with a Recorder.
+		Transport http.RoundTripper
+	}
+
+	// FieldMapping holds dot-separated paths to the detail fields in a
+	// provider response, e.g. "data.lyrics".
+	FieldMapping struct {
+		ReleaseDate string
+		Text        string
+		Link        string
+	}
+
+	ExternalAPI struct {
+		cfg    Config
+		client *http.Client
+	}
+)
+
+func NewExternalAPI(cfg Config) *ExternalAPI {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.GroupParam == "" {
+		cfg.GroupParam = "group"
+	}
+	if cfg.SongParam == "" {
+		cfg.SongParam = "song"
+	}
+	if cfg.Fields.ReleaseDate == "" {
+		cfg.Fields.ReleaseDate = "releaseDate"
+	}
+	if cfg.Fields.Text == "" {
+		cfg.Fields.Text = "text"
+	}
+	if cfg.Fields.Link == "" {
+		cfg.Fields.Link = "link"
+	}
 
-func NewExternalAPI(baseURL string) *ExternalAPI {
 	return &ExternalAPI{
-		baseURL: baseURL,
+		cfg: cfg,
 		client: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:   cfg.Timeout,
+			Transport: cfg.Transport,
 		},
 	}
 }
 
 func (c *ExternalAPI) FetchSongDetail(ctx context.Context, group, song string) (*models.SongDetail, error) {
-	u, err := url.Parse(c.baseURL)
+	ctx, span := tracing.Start(ctx, "ExternalAPI.FetchSongDetail", trace.WithAttributes(
+		attribute.String("provider", c.cfg.Name),
+		attribute.String("song.group", group),
+		attribute.String("song.name", song),
+	))
+	songDetail, err := c.fetchWithRetries(ctx, group, song)
+	metrics.CountUpstreamLookup(c.cfg.Name, lookupOutcome(err))
+	tracing.End(span, err)
+	return songDetail, err
+}
+
+func (c *ExternalAPI) Name() string {
+	return c.cfg.Name
+}
+
+// Ping tells whether the provider can be reached. Any answer below 500
+// counts, the base URL alone need not be a valid lookup.
+func (c *ExternalAPI) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.BaseURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("provider %s unreachable: %w", c.cfg.Name, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("provider %s answered %d", c.cfg.Name, resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *ExternalAPI) fetchWithRetries(ctx context.Context, group, song string) (*models.SongDetail, error) {
+	u, err := url.Parse(c.cfg.BaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid base URL: %w", err)
 	}
 
 	q := u.Query()
-	q.Set("group", group)
-	q.Set("song", song)
+	q.Set(c.cfg.GroupParam, group)
+	q.Set(c.cfg.SongParam, song)
 	u.RawQuery = q.Encode()
 
-	slog.Debug("Fetching song detail", slog.String("url", u.String()))
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		attemptCtx, span := tracing.Start(ctx, "GET "+c.cfg.Name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			semconv.HTTPRequestMethodGet,
+			semconv.URLFull(u.String()),
+			attribute.Int("attempt", attempt),
+		))
+		songDetail, err := c.fetchOnce(attemptCtx, u.String())
+		metrics.ObserveUpstreamRequest(c.cfg.Name, time.Since(start))
+		tracing.End(span, err)
+		if err == nil {
+			logging.FromContext(ctx).Debug("Song detail fetched", slog.String("provider", c.cfg.Name), slog.String("url", u.String()), slog.Int("attempt", attempt), slog.Duration("duration", time.Since(start)))
+			return songDetail, nil
+		}
+
+		if ctx.Err() != nil || !isRetryable(err) || attempt > c.cfg.Retry.MaxRetries {
+			logging.FromContext(ctx).Warn("Song detail request failed", slog.String("provider", c.cfg.Name), slog.String("url", u.String()), slog.Int("attempt", attempt), slog.Any("error", err))
+			return nil, toAppError(err, group, song)
+		}
+
+		if wait := retryAfter(err); c.cfg.Retry.waitsTooLong(wait) {
+			logging.FromContext(ctx).Warn("Song detail request failed, provider asks to wait too long to retry", slog.String("provider", c.cfg.Name), slog.String("url", u.String()), slog.Int("attempt", attempt), slog.Duration("retry_after", wait), slog.Any("error", err))
+			return nil, toAppError(err, group, song)
+		}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		delay := c.cfg.Retry.delay(attempt, retryAfter(err))
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			logging.FromContext(ctx).Warn("Song detail request failed, no time left to retry", slog.String("provider", c.cfg.Name), slog.String("url", u.String()), slog.Int("attempt", attempt), slog.Any("error", err))
+			return nil, toAppError(err, group, song)
+		}
+
+		logging.FromContext(ctx).Warn("Song detail request failed, retrying", slog.String("provider", c.cfg.Name), slog.String("url", u.String()), slog.Int("attempt", attempt), slog.Duration("delay", delay), slog.Any("error", err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, toAppError(ctx.Err(), group, song)
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *ExternalAPI) fetchOnce(ctx context.Context, u string) (*models.SongDetail, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	// Lets the provider's logs be matched with ours.
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -51,14 +194,143 @@ func (c *ExternalAPI) FetchSongDetail(ctx context.Context, group, song string) (
 
 	defer resp.Body.Close()
 
+	trace.SpanFromContext(ctx).SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		// Reading the body to the end lets the connection be reused.
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, &decodeError{err: err}
+	}
+
+	return c.mapDetail(body)
+}
+
+// mapDetail picks the detail fields out of a provider response and brings
+// a release date in a custom format to the ISO form.
+func (c *ExternalAPI) mapDetail(body map[string]interface{}) (*models.SongDetail, error) {
+	songDetail := &models.SongDetail{
+		ReleaseDate: lookupString(body, c.cfg.Fields.ReleaseDate),
+		Text:        lookupString(body, c.cfg.Fields.Text),
+		Link:        lookupString(body, c.cfg.Fields.Link),
+	}
+
+	if songDetail.ReleaseDate != "" && c.cfg.DateFormat != "" {
+		date, err := releasedate.ParseLayout(songDetail.ReleaseDate, c.cfg.DateFormat)
+		if err != nil {
+			return nil, &decodeError{err: fmt.Errorf("release date %q: %w", songDetail.ReleaseDate, err)}
+		}
+		songDetail.ReleaseDate = date.String()
+	}
+
+	return songDetail, nil
+}
+
+func lookupString(body map[string]interface{}, path string) string {
+	var value interface{} = body
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = obj[key]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// StatusError is returned when the provider answers with a non-200 status.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("failed to decode response: %v", e.err)
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrNoInteraction) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var decodeErr *decodeError
+	return !errors.As(err, &decodeErr)
+}
+
+func retryAfter(err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter
+	}
+	return 0
+}
+
+// lookupOutcome names the result of a lookup for the metrics.
+func lookupOutcome(err error) string {
+	switch {
+	case err == nil:
+		return metrics.OutcomeSuccess
+	case errors.Is(err, apperrors.ErrNotFound):
+		return metrics.OutcomeNotFound
+	case errors.Is(err, apperrors.ErrUpstreamRejected):
+		return metrics.OutcomeRejected
+	default:
+		return metrics.OutcomeUnavailable
+	}
+}
+
+func toAppError(err error, group, song string) error {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusNotFound:
+			return apperrors.NotFound("song_detail_not_found", "no details found for %q by %q", song, group).Wrap(err)
+		case statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError:
+			return apperrors.UpstreamUnavailable("upstream_unavailable", "song details provider is unavailable").Wrap(err)
+		default:
+			return apperrors.UpstreamRejected("upstream_rejected", "song details provider rejected the request with status %d", statusErr.StatusCode).Wrap(err)
+		}
+	}
+
+	if errors.Is(err, ErrNoInteraction) {
+		return apperrors.UpstreamUnavailable("vcr_no_interaction", "no recorded response for this request").Wrap(err)
 	}
 
-	var songDetail models.SongDetail
-	if err := json.NewDecoder(resp.Body).Decode(&songDetail); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	var decodeErr *decodeError
+	if errors.As(err, &decodeErr) {
+		return apperrors.UpstreamRejected("upstream_invalid_response", "song details provider returned an invalid response").Wrap(err)
 	}
 
-	return &songDetail, nil
+	return apperrors.UpstreamUnavailable("upstream_unavailable", "song details provider is unavailable").Wrap(err)
 }
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy describes how failed requests to the provider are retried.
+// Network errors, 429 and 5xx responses are retried, other errors are not.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// delay returns the pause before the next attempt: exponential backoff with
+// jitter, capped at MaxDelay. A Retry-After hint from the provider wins if it
+// asks for a longer pause, but not beyond MaxDelay either; callers give up
+// instead, see waitsTooLong.
+func (p RetryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	base := p.BaseDelay
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+
+	backoff := base << (attempt - 1)
+	if backoff <= 0 || (p.MaxDelay > 0 && backoff > p.MaxDelay) {
+		backoff = p.MaxDelay
+	}
+
+	// Equal jitter: half of the backoff is fixed, the other half is random.
+	half := backoff / 2
+	backoff = half + time.Duration(rand.Int64N(int64(half)+1))
+
+	if retryAfter > backoff {
+		backoff = retryAfter
+	}
+	if p.MaxDelay > 0 && backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+	return backoff
+}
+
+// waitsTooLong reports whether the provider asks for a longer pause than
+// MaxDelay, which would stretch the lookup past FetchBudget.
+func (p RetryPolicy) waitsTooLong(retryAfter time.Duration) bool {
+	return p.MaxDelay > 0 && retryAfter > p.MaxDelay
+}
+
+// FetchBudget is the longest a lookup with all its retries may take: every
+// attempt running into timeout plus a pause of MaxDelay before each retry.
+func FetchBudget(timeout time.Duration, retry RetryPolicy) time.Duration {
+	return timeout*time.Duration(retry.MaxRetries+1) + time.Duration(retry.MaxRetries)*retry.MaxDelay
+}
+
+// parseRetryAfter understands both forms of the Retry-After header:
+// delay in seconds and an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		name       string
+		policy     RetryPolicy
+		attempt    int
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{"first attempt", policy, 1, 0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"doubles per attempt", policy, 3, 0, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"capped at max delay", policy, 10, 0, 500 * time.Millisecond, time.Second},
+		{"shift overflow capped", policy, 100, 0, 500 * time.Millisecond, time.Second},
+		{"longer retry-after wins", policy, 1, 800 * time.Millisecond, 800 * time.Millisecond, 800 * time.Millisecond},
+		{"shorter retry-after ignored", policy, 3, time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"retry-after capped at max delay", policy, 1, time.Minute, time.Second, time.Second},
+		{"default base delay", RetryPolicy{}, 1, 0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"no max delay keeps retry-after", RetryPolicy{}, 1, time.Minute, time.Minute, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The jitter is random, so try a few times.
+			for i := 0; i < 50; i++ {
+				got := tt.policy.delay(tt.attempt, tt.retryAfter)
+				if got < tt.min || got > tt.max {
+					t.Fatalf("delay(%d, %s) = %s, want between %s and %s", tt.attempt, tt.retryAfter, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyWaitsTooLong(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     RetryPolicy
+		retryAfter time.Duration
+		want       bool
+	}{
+		{"no hint", RetryPolicy{MaxDelay: time.Second}, 0, false},
+		{"within max delay", RetryPolicy{MaxDelay: time.Second}, time.Second, false},
+		{"beyond max delay", RetryPolicy{MaxDelay: time.Second}, 2 * time.Second, true},
+		{"no max delay", RetryPolicy{}, time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.waitsTooLong(tt.retryAfter); got != tt.want {
+				t.Errorf("waitsTooLong(%s) = %v, want %v", tt.retryAfter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"empty", "", 0},
+		{"seconds", "120", 2 * time.Minute},
+		{"negative seconds", "-5", 0},
+		{"http date", now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{"date in the past", now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"garbage", "soon", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchBudget(t *testing.T) {
+	retry := RetryPolicy{MaxRetries: 2, MaxDelay: 5 * time.Second}
+	if got, want := FetchBudget(10*time.Second, retry), 40*time.Second; got != want {
+		t.Errorf("FetchBudget = %s, want %s", got, want)
+	}
+}
+
+func TestFetchBudgetCoversAllAttempts(t *testing.T) {
+	// Every attempt but the last runs into the timeout, the last one needs
+	// half of it.
+	timeout := 200 * time.Millisecond
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			<-r.Context().Done()
+			return
+		}
+		time.Sleep(timeout / 2)
+		w.Write([]byte(`{"text": "lyrics"}`))
+	}))
+	defer server.Close()
+
+	retry := RetryPolicy{MaxRetries: 2, BaseDelay: timeout, MaxDelay: timeout}
+	fetcher := NewCachedFetcher("test", NewExternalAPI(Config{BaseURL: server.URL, Timeout: timeout, Retry: retry}),
+		CacheConfig{FetchTimeout: FetchBudget(timeout, retry)})
+
+	detail, err := fetcher.FetchSongDetail(context.Background(), "Muse", "Uprising")
+	if err != nil {
+		t.Fatalf("lookup failed after %d requests: %v", requests.Load(), err)
+	}
+	if detail.Text != "lyrics" || requests.Load() != 3 {
+		t.Errorf("detail = %+v after %d requests", detail, requests.Load())
+	}
+}
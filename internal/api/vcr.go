@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+)
+
+const (
+	VCRModeOff    = "off"
+	VCRModeRecord = "record"
+	VCRModeReplay = "replay"
+
+	redacted = "[REDACTED]"
+)
+
+// ErrNoInteraction is returned in replay mode for a request the cassette does not have.
+var ErrNoInteraction = errors.New("vcr: no recorded interaction")
+
+// sensitiveHeaders are never written to cassettes.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+}
+
+// sensitiveParams are query parameters masked in cassette URLs, compared
+// case-insensitively.
+var sensitiveParams = []string{
+	"api_key",
+	"apikey",
+	"key",
+	"token",
+	"access_token",
+	"secret",
+	"password",
+}
+
+type (
+	Cassette struct {
+		Interactions []Interaction `json:"interactions"`
+	}
+
+	Interaction struct {
+		Request  RecordedRequest  `json:"request"`
+		Response RecordedResponse `json:"response"`
+	}
+
+	RecordedRequest struct {
+		Method  string      `json:"method"`
+		URL     string      `json:"url"`
+		Headers http.Header `json:"headers,omitempty"`
+	}
+
+	RecordedResponse struct {
+		Status  int         `json:"status"`
+		Headers http.Header `json:"headers,omitempty"`
+		Body    string      `json:"body"`
+	}
+
+	// Recorder is an http.RoundTripper that saves provider responses to a
+	// cassette file (record mode) or serves them from it (replay mode).
+	// Requests are matched by method and URL, with sensitive query
+	// parameters masked on both sides.
+	Recorder struct {
+		mode string
+		path string
+		next http.RoundTripper
+
+		mu       sync.Mutex
+		cassette Cassette
+		played   map[string]int
+	}
+)
+
+func NewRecorder(mode, path string, next http.RoundTripper) (*Recorder, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	r := &Recorder{
+		mode:   mode,
+		path:   path,
+		next:   next,
+		played: make(map[string]int),
+	}
+
+	switch mode {
+	case VCRModeReplay:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read cassette: %w", err)
+		}
+		if err := json.Unmarshal(content, &r.cassette); err != nil {
+			return nil, fmt.Errorf("parse cassette %s: %w", path, err)
+		}
+	case VCRModeRecord:
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("create cassette directory: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown vcr mode %q", mode)
+	}
+
+	return r, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.mode == VCRModeReplay {
+		return r.replay(req)
+	}
+	return r.record(req)
+}
+
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := req.Method + " " + redactURL(req.URL)
+
+	// Identical requests get the recorded answers in order, the last one repeats.
+	var matches []Interaction
+	for _, interaction := range r.cassette.Interactions {
+		if interaction.Request.Method+" "+interaction.Request.URL == key {
+			matches = append(matches, interaction)
+		}
+	}
+	if len(matches) == 0 {
+		logging.FromContext(req.Context()).Error("Unmatched request in replay mode", slog.String("request", key), slog.String("cassette", r.path))
+		return nil, fmt.Errorf("%w for %s", ErrNoInteraction, key)
+	}
+
+	i := r.played[key]
+	if i >= len(matches) {
+		i = len(matches) - 1
+	}
+	r.played[key]++
+
+	recorded := matches[i].Response
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Headers.Clone(),
+		Body:          io.NopCloser(bytes.NewBufferString(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     redactURL(req.URL),
+			Headers: redact(req.Header),
+		},
+		Response: RecordedResponse{
+			Status:  resp.StatusCode,
+			Headers: redact(resp.Header),
+			Body:    string(body),
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	if err := r.save(); err != nil {
+		slog.Error("Failed to save cassette", slog.String("cassette", r.path), slog.Any("error", err))
+	}
+
+	return resp, nil
+}
+
+// save writes the cassette through a temporary file so a crash never leaves
+// a truncated cassette behind.
+func (r *Recorder) save() error {
+	content, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+func redact(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+
+	clean := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if clean.Get(name) != "" {
+			clean.Set(name, redacted)
+		}
+	}
+	return clean
+}
+
+// redactURL masks the values of sensitive query parameters. URLs without
+// them are returned as they are.
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	found := false
+	for name, values := range query {
+		if slices.Contains(sensitiveParams, strings.ToLower(name)) {
+			for i := range values {
+				values[i] = redacted
+			}
+			found = true
+		}
+	}
+	if !found {
+		return u.String()
+	}
+
+	clean := *u
+	clean.RawQuery = query.Encode()
+	return clean.String()
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// get sends a GET through the recorder and returns the status and body.
+func get(t *testing.T, r *Recorder, url string) (int, string, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Api-Key", "header-secret")
+
+	resp, err := r.RoundTrip(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+func TestRecorderRecordAndReplay(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Set-Cookie", "session=abc")
+		if r.URL.Query().Get("song") == "Missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"text": "call ` + strconv.Itoa(calls) + `"}`))
+	}))
+	defer server.Close()
+
+	cassette := filepath.Join(t.TempDir(), "cassettes", "provider.json")
+	recorder, err := NewRecorder(VCRModeRecord, cassette, nil)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+
+	for _, url := range []string{
+		server.URL + "?song=Uprising&api_key=first-secret",
+		server.URL + "?song=Uprising&api_key=first-secret",
+		server.URL + "?song=Missing",
+	} {
+		if _, _, err := get(t, recorder, url); err != nil {
+			t.Fatalf("record %s: %v", url, err)
+		}
+	}
+
+	content, err := os.ReadFile(cassette)
+	if err != nil {
+		t.Fatalf("read cassette: %v", err)
+	}
+	for _, secret := range []string{"first-secret", "header-secret", "session=abc"} {
+		if strings.Contains(string(content), secret) {
+			t.Errorf("cassette contains %q", secret)
+		}
+	}
+
+	player, err := NewRecorder(VCRModeReplay, cassette, nil)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	server.Close()
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		body   string
+		err    error
+	}{
+		// The key differs, but it is masked on both sides.
+		{name: "first answer", url: server.URL + "?song=Uprising&api_key=other-secret", status: http.StatusOK, body: `{"text": "call 1"}`},
+		{name: "second answer", url: server.URL + "?song=Uprising&api_key=x", status: http.StatusOK, body: `{"text": "call 2"}`},
+		{name: "last answer repeats", url: server.URL + "?song=Uprising&api_key=first-secret", status: http.StatusOK, body: `{"text": "call 2"}`},
+		{name: "recorded error status", url: server.URL + "?song=Missing", status: http.StatusNotFound},
+		{name: "unmatched request", url: server.URL + "?song=Unknown", err: ErrNoInteraction},
+		{name: "unmatched without the masked parameter", url: server.URL + "?song=Uprising", err: ErrNoInteraction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body, err := get(t, player, tt.url)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if status != tt.status || body != tt.body {
+				t.Errorf("got %d %q, want %d %q", status, body, tt.status, tt.body)
+			}
+		})
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://api.test/info?song=Uprising&group=Muse", "http://api.test/info?song=Uprising&group=Muse"},
+		{"http://api.test/info?song=Uprising&api_key=s3cret", "http://api.test/info?api_key=%5BREDACTED%5D&song=Uprising"},
+		{"http://api.test/info?Token=a&token=b", "http://api.test/info?Token=%5BREDACTED%5D&token=%5BREDACTED%5D"},
+		{"http://api.test/info", "http://api.test/info"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := redactURL(req.URL); got != tt.want {
+				t.Errorf("redactURL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of domain errors. Handlers map them to HTTP status codes, lower
+// layers only decide which kind a failure belongs to.
+var (
+	ErrNotFound            = errors.New("not found")
+	ErrConflict            = errors.New("conflict")
+	ErrValidation          = errors.New("validation failed")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	ErrUpstreamRejected    = errors.New("upstream rejected request")
+	ErrUnauthorized        = errors.New("unauthorized")
+	ErrForbidden           = errors.New("forbidden")
+	ErrRateLimited         = errors.New("rate limited")
+)
+
+// Error is a domain error with a stable machine-readable code.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+func newError(kind error, code, format string, args ...interface{}) *Error {
+	return &Error{
+		Kind:    kind,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func NotFound(code, format string, args ...interface{}) *Error {
+	return newError(ErrNotFound, code, format, args...)
+}
+
+func Conflict(code, format string, args ...interface{}) *Error {
+	return newError(ErrConflict, code, format, args...)
+}
+
+func Validation(code, format string, args ...interface{}) *Error {
+	return newError(ErrValidation, code, format, args...)
+}
+
+func UpstreamUnavailable(code, format string, args ...interface{}) *Error {
+	return newError(ErrUpstreamUnavailable, code, format, args...)
+}
+
+func UpstreamRejected(code, format string, args ...interface{}) *Error {
+	return newError(ErrUpstreamRejected, code, format, args...)
+}
+
+func Unauthorized(code, format string, args ...interface{}) *Error {
+	return newError(ErrUnauthorized, code, format, args...)
+}
+
+func Forbidden(code, format string, args ...interface{}) *Error {
+	return newError(ErrForbidden, code, format, args...)
+}
+
+func RateLimited(code, format string, args ...interface{}) *Error {
+	return newError(ErrRateLimited, code, format, args...)
+}
+
+// Wrap attaches the underlying cause to the error.
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// As returns the first *Error in the chain of err.
+func As(err error) (*Error, bool) {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr, true
+	}
+	return nil, false
+}
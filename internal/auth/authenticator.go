@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+// Authenticator accepts both API keys and user access tokens, API keys are
+// told apart by their prefix.
+type Authenticator struct {
+	keys     *Keys
+	sessions *Sessions
+}
+
+func NewAuthenticator(keys *Keys, sessions *Sessions) *Authenticator {
+	return &Authenticator{keys: keys, sessions: sessions}
+}
+
+func (a *Authenticator) Authenticate(ctx context.Context, credential string) (*models.Identity, error) {
+	if strings.HasPrefix(credential, keyPrefix) {
+		return a.keys.Authenticate(ctx, credential)
+	}
+	return a.sessions.Authenticate(ctx, credential)
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, identity *models.Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the caller of the request, nil if it is anonymous.
+func IdentityFromContext(ctx context.Context) *models.Identity {
+	identity, _ := ctx.Value(identityKey{}).(*models.Identity)
+	return identity
+}
+
+// UserID returns the ID of the user making the request. It is false for
+// anonymous callers and API keys.
+func UserID(ctx context.Context) (int, bool) {
+	identity := IdentityFromContext(ctx)
+	if identity == nil || identity.Kind != models.IdentityUser {
+		return 0, false
+	}
+	return identity.ID, true
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+// keyPrefix starts every API key so leaked keys are easy to search for.
+const keyPrefix = "slk_"
+
+type (
+	KeyStore interface {
+		CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) error
+		GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+		ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+		RevokeAPIKey(ctx context.Context, id int) error
+		TouchAPIKey(ctx context.Context, id int) error
+	}
+
+	// Keys issues and checks API keys. Keys look like slk_<id>_<secret>,
+	// only their SHA-256 is stored.
+	Keys struct {
+		store KeyStore
+	}
+)
+
+func NewKeys(store KeyStore) *Keys {
+	return &Keys{store: store}
+}
+
+func (k *Keys) Create(ctx context.Context, req models.NewAPIKeyRequest) (*models.CreatedAPIKey, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, apperrors.Validation("missing_fields", "name is required")
+	}
+	if len(req.Scopes) == 0 {
+		return nil, apperrors.Validation("missing_scopes", "at least one scope is required")
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(models.Scopes, scope) {
+			return nil, apperrors.Validation("invalid_scope", "unknown scope %q, expected one of %v", scope, models.Scopes)
+		}
+	}
+
+	id, err := randomHex(4)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, err
+	}
+
+	created := &models.CreatedAPIKey{
+		APIKey: models.APIKey{
+			Name:   req.Name,
+			Prefix: keyPrefix + id,
+			Scopes: req.Scopes,
+		},
+		Key: keyPrefix + id + "_" + secret,
+	}
+	if err := k.store.CreateAPIKey(ctx, &created.APIKey, hashKey(created.Key)); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("API key created", slog.Int("key_id", created.ID), slog.String("name", created.Name), slog.Any("scopes", created.Scopes))
+	return created, nil
+}
+
+// Authenticate returns the identity of a key. Unknown and revoked keys are
+// rejected as unauthorized.
+func (k *Keys) Authenticate(ctx context.Context, key string) (*models.Identity, error) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return nil, apperrors.Unauthorized("invalid_api_key", "invalid api key")
+	}
+
+	apiKey, err := k.store.GetAPIKeyByHash(ctx, hashKey(key))
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return nil, apperrors.Unauthorized("invalid_api_key", "invalid api key")
+		}
+		return nil, err
+	}
+
+	// Recording every use would write on every request, once a minute is enough.
+	if apiKey.LastUsedAt == nil || time.Since(*apiKey.LastUsedAt) > time.Minute {
+		if err := k.store.TouchAPIKey(ctx, apiKey.ID); err != nil {
+			logging.FromContext(ctx).Warn("Failed to record api key use", slog.Int("key_id", apiKey.ID), slog.Any("error", err))
+		}
+	}
+
+	return &models.Identity{
+		Kind:   models.IdentityAPIKey,
+		ID:     apiKey.ID,
+		Name:   apiKey.Name,
+		Role:   roleForScopes(apiKey.Scopes),
+		Scopes: apiKey.Scopes,
+	}, nil
+}
+
+func (k *Keys) List(ctx context.Context) ([]models.APIKey, error) {
+	return k.store.ListAPIKeys(ctx)
+}
+
+func (k *Keys) Revoke(ctx context.Context, id int) error {
+	if err := k.store.RevokeAPIKey(ctx, id); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("API key revoked", slog.Int("key_id", id))
+	return nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate random id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
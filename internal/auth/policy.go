@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"slices"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+// permissions lists what each role may do on top of the roles before it in
+// models.Roles.
+var permissions = map[string][]string{
+	models.RoleViewer:      {models.PermReadSongs},
+	models.RoleContributor: {models.PermCreateSongs},
+	models.RoleEditor:      {models.PermUpdateSongs, models.PermDeleteSongs},
+	models.RoleAdmin:       {models.PermManageUsers, models.PermManageSystem},
+}
+
+// scopeRoles maps API key scopes to the role a key acts as.
+var scopeRoles = map[string]string{
+	models.ScopeRead:  models.RoleViewer,
+	models.ScopeWrite: models.RoleEditor,
+	models.ScopeAdmin: models.RoleAdmin,
+}
+
+// Can reports whether the identity's role grants the permission.
+func Can(identity *models.Identity, permission string) bool {
+	if identity == nil {
+		return false
+	}
+	return slices.Contains(granted(identity.Role), permission)
+}
+
+// KnownPermission reports whether some role grants the permission. Can denies
+// all others.
+func KnownPermission(permission string) bool {
+	return slices.Contains(granted(models.RoleAdmin), permission)
+}
+
+// granted returns everything the role may do, nothing for unknown roles.
+func granted(role string) []string {
+	var perms []string
+	rank := slices.Index(models.Roles, role)
+	for _, r := range models.Roles[:rank+1] {
+		perms = append(perms, permissions[r]...)
+	}
+	return perms
+}
+
+// roleForScopes returns the highest role the scopes of an API key grant.
+func roleForScopes(scopes []string) string {
+	role := ""
+	for _, scope := range scopes {
+		if r, ok := scopeRoles[scope]; ok && slices.Index(models.Roles, r) > slices.Index(models.Roles, role) {
+			role = r
+		}
+	}
+	return role
+}
+
+func validRole(role string) bool {
+	return slices.Contains(models.Roles, role)
+}
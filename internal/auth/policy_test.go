@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		name       string
+		identity   *models.Identity
+		permission string
+		want       bool
+	}{
+		{"anonymous", nil, models.PermReadSongs, false},
+		{"viewer reads", &models.Identity{Role: models.RoleViewer}, models.PermReadSongs, true},
+		{"viewer cannot create", &models.Identity{Role: models.RoleViewer}, models.PermCreateSongs, false},
+		{"contributor inherits read", &models.Identity{Role: models.RoleContributor}, models.PermReadSongs, true},
+		{"contributor creates", &models.Identity{Role: models.RoleContributor}, models.PermCreateSongs, true},
+		{"contributor cannot delete", &models.Identity{Role: models.RoleContributor}, models.PermDeleteSongs, false},
+		{"editor deletes", &models.Identity{Role: models.RoleEditor}, models.PermDeleteSongs, true},
+		{"editor cannot manage users", &models.Identity{Role: models.RoleEditor}, models.PermManageUsers, false},
+		{"admin manages the system", &models.Identity{Role: models.RoleAdmin}, models.PermManageSystem, true},
+		{"admin reads", &models.Identity{Role: models.RoleAdmin}, models.PermReadSongs, true},
+		{"unknown role", &models.Identity{Role: "owner"}, models.PermReadSongs, false},
+		{"no role", &models.Identity{}, models.PermReadSongs, false},
+		{"unknown permission", &models.Identity{Role: models.RoleAdmin}, "songs:publish", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Can(tt.identity, tt.permission); got != tt.want {
+				t.Errorf("Can(%v, %q) = %v, want %v", tt.identity, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKnownPermission(t *testing.T) {
+	for _, perm := range []string{models.PermReadSongs, models.PermCreateSongs, models.PermUpdateSongs, models.PermDeleteSongs, models.PermManageUsers, models.PermManageSystem} {
+		if !KnownPermission(perm) {
+			t.Errorf("KnownPermission(%q) = false", perm)
+		}
+	}
+	if KnownPermission("songs:publish") {
+		t.Error(`KnownPermission("songs:publish") = true`)
+	}
+}
+
+func TestRoleForScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		want   string
+	}{
+		{"none", nil, ""},
+		{"read", []string{models.ScopeRead}, models.RoleViewer},
+		{"write", []string{models.ScopeWrite}, models.RoleEditor},
+		{"highest wins", []string{models.ScopeAdmin, models.ScopeRead}, models.RoleAdmin},
+		{"unknown scope grants nothing", []string{"superuser"}, ""},
+		{"unknown scope is skipped", []string{"superuser", models.ScopeRead}, models.RoleViewer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roleForScopes(tt.scopes); got != tt.want {
+				t.Errorf("roleForScopes(%v) = %q, want %q", tt.scopes, got, tt.want)
+			}
+		})
+	}
+}
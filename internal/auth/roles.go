@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	RoleStore interface {
+		ListUsers(ctx context.Context) ([]models.User, error)
+		SetUserRole(ctx context.Context, id int, role string) (*models.User, error)
+	}
+
+	// Roles lets admins see users and assign their roles.
+	Roles struct {
+		store RoleStore
+	}
+)
+
+func NewRoles(store RoleStore) *Roles {
+	return &Roles{store: store}
+}
+
+func (r *Roles) ListUsers(ctx context.Context) ([]models.User, error) {
+	return r.store.ListUsers(ctx)
+}
+
+// Assign gives the user a role. It takes effect with the user's next request.
+func (r *Roles) Assign(ctx context.Context, userID int, role string) (*models.User, error) {
+	if !validRole(role) {
+		return nil, apperrors.Validation("invalid_role", "unknown role %q, expected one of %v", role, models.Roles)
+	}
+	if id, ok := UserID(ctx); ok && id == userID && role != models.RoleAdmin {
+		return nil, apperrors.Conflict("own_role", "admins cannot take away their own admin role")
+	}
+
+	user, err := r.store.SetUserRole(ctx, userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	by := IdentityFromContext(ctx)
+	attrs := []any{slog.Int("user_id", userID), slog.String("role", role)}
+	if by != nil {
+		attrs = append(attrs, slog.Group("by", slog.String("kind", by.Kind), slog.Int("id", by.ID)))
+	}
+	logging.FromContext(ctx).Info("Role assigned", attrs...)
+	return user, nil
+}
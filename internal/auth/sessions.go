@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	tokenUseAccess  = "access"
+	tokenUseRefresh = "refresh"
+
+	bcryptCost        = 12
+	minPasswordLength = 8
+	// bcrypt ignores everything after 72 bytes.
+	maxPasswordLength = 72
+)
+
+type (
+	UserStore interface {
+		CreateUser(ctx context.Context, user *models.User, passwordHash string) error
+		GetUserByEmail(ctx context.Context, email string) (*models.User, string, error)
+		CreateSession(ctx context.Context, session *models.Session, tokenID string, expiresAt time.Time) error
+		GetSession(ctx context.Context, id string) (*models.Session, error)
+		RotateRefreshToken(ctx context.Context, tokenID, newTokenID string, expiresAt time.Time) (*models.Session, error)
+		RevokeSession(ctx context.Context, id string) error
+	}
+
+	SessionConfig struct {
+		// Secret signs the tokens with HS256.
+		Secret     []byte
+		Issuer     string
+		AccessTTL  time.Duration
+		RefreshTTL time.Duration
+		// Registration allows anyone to sign up.
+		Registration bool
+	}
+
+	// Sessions registers users and logs them in. A login issues a short-lived
+	// access token and a refresh token, both JWTs. A refresh token can be
+	// exchanged once for a new pair; using it again revokes the session.
+	Sessions struct {
+		store UserStore
+		cfg   SessionConfig
+	}
+
+	claims struct {
+		jwt.RegisteredClaims
+		Email     string `json:"email,omitempty"`
+		SessionID string `json:"sid"`
+		TokenUse  string `json:"token_use"`
+	}
+)
+
+// dummyHash is compared against when the user does not exist, so a login
+// takes as long for unknown emails as for wrong passwords.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("song-library"), bcryptCost)
+	return hash
+})
+
+func NewSessions(store UserStore, cfg SessionConfig) *Sessions {
+	if cfg.Issuer == "" {
+		cfg.Issuer = "songlibrary"
+	}
+	if cfg.AccessTTL <= 0 {
+		cfg.AccessTTL = 15 * time.Minute
+	}
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = 30 * 24 * time.Hour
+	}
+	return &Sessions{store: store, cfg: cfg}
+}
+
+func (s *Sessions) Register(ctx context.Context, creds models.Credentials) (*models.User, error) {
+	if !s.cfg.Registration {
+		return nil, apperrors.Forbidden("registration_disabled", "registration is disabled")
+	}
+
+	email, err := normalizeEmail(creds.Email)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds.Password) < minPasswordLength || len(creds.Password) > maxPasswordLength {
+		return nil, apperrors.Validation("invalid_password", "password must be %d to %d bytes long", minPasswordLength, maxPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcryptCost)
+	if err != nil {
+		return nil, fmt.Errorf("hash password: %w", err)
+	}
+
+	user := &models.User{Email: email}
+	if err := s.store.CreateUser(ctx, user, string(hash)); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("User registered", slog.Int("user_id", user.ID))
+	return user, nil
+}
+
+// Login checks the password and starts a new session.
+func (s *Sessions) Login(ctx context.Context, creds models.Credentials) (*models.TokenPair, error) {
+	invalid := apperrors.Unauthorized("invalid_credentials", "invalid email or password")
+
+	user, hash, err := s.store.GetUserByEmail(ctx, strings.TrimSpace(creds.Email))
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			bcrypt.CompareHashAndPassword(dummyHash(), []byte(creds.Password))
+			return nil, invalid
+		}
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(creds.Password)); err != nil {
+		logging.FromContext(ctx).Warn("Login failed", slog.Int("user_id", user.ID))
+		return nil, invalid
+	}
+
+	session := &models.Session{UserID: user.ID}
+	if session.ID, err = randomHex(16); err != nil {
+		return nil, err
+	}
+	refreshID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.store.CreateSession(ctx, session, refreshID, now.Add(s.cfg.RefreshTTL)); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("User logged in", slog.Int("user_id", user.ID), slog.String("session_id", session.ID))
+	return s.issue(user.ID, user.Email, session.ID, refreshID, now)
+}
+
+// Refresh exchanges a refresh token for a new token pair.
+func (s *Sessions) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	c, err := s.parse(refreshToken, tokenUseRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	newRefreshID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session, err := s.store.RotateRefreshToken(ctx, c.ID, newRefreshID, now.Add(s.cfg.RefreshTTL))
+	if err != nil {
+		switch {
+		case errors.Is(err, apperrors.ErrConflict):
+			logging.FromContext(ctx).Warn("Refresh token reused, session revoked", slog.String("session_id", c.SessionID), slog.String("subject", c.Subject))
+			return nil, apperrors.Unauthorized("refresh_token_reused", "refresh token was already used, log in again").Wrap(err)
+		case errors.Is(err, apperrors.ErrNotFound):
+			return nil, apperrors.Unauthorized("invalid_refresh_token", "refresh token is expired or revoked").Wrap(err)
+		}
+		return nil, err
+	}
+
+	return s.issue(session.UserID, c.Email, session.ID, newRefreshID, now)
+}
+
+// Logout revokes the session of the refresh token, its access tokens stop
+// working as well.
+func (s *Sessions) Logout(ctx context.Context, refreshToken string) error {
+	c, err := s.parse(refreshToken, tokenUseRefresh)
+	if err != nil {
+		return err
+	}
+	if err := s.store.RevokeSession(ctx, c.SessionID); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("User logged out", slog.String("subject", c.Subject), slog.String("session_id", c.SessionID))
+	return nil
+}
+
+// Authenticate returns the identity of an access token. Tokens of revoked
+// sessions are rejected.
+func (s *Sessions) Authenticate(ctx context.Context, accessToken string) (*models.Identity, error) {
+	c, err := s.parse(accessToken, tokenUseAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.store.GetSession(ctx, c.SessionID)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return nil, apperrors.Unauthorized("invalid_token", "invalid access token")
+		}
+		return nil, err
+	}
+	if session.RevokedAt != nil {
+		return nil, apperrors.Unauthorized("session_revoked", "the session has ended, log in again")
+	}
+
+	return &models.Identity{
+		Kind:      models.IdentityUser,
+		ID:        session.UserID,
+		Name:      c.Email,
+		Role:      session.Role,
+		SessionID: session.ID,
+	}, nil
+}
+
+func (s *Sessions) issue(userID int, email, sessionID, refreshID string, now time.Time) (*models.TokenPair, error) {
+	accessID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := s.sign(claims{
+		RegisteredClaims: s.registered(userID, accessID, now, s.cfg.AccessTTL),
+		Email:            email,
+		SessionID:        sessionID,
+		TokenUse:         tokenUseAccess,
+	})
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := s.sign(claims{
+		RegisteredClaims: s.registered(userID, refreshID, now, s.cfg.RefreshTTL),
+		Email:            email,
+		SessionID:        sessionID,
+		TokenUse:         tokenUseRefresh,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.cfg.AccessTTL.Seconds()),
+	}, nil
+}
+
+func (s *Sessions) registered(userID int, tokenID string, now time.Time, ttl time.Duration) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Issuer:    s.cfg.Issuer,
+		Subject:   strconv.Itoa(userID),
+		ID:        tokenID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+}
+
+func (s *Sessions) sign(c claims) (string, error) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString(s.cfg.Secret)
+	if err != nil {
+		return "", fmt.Errorf("sign token: %w", err)
+	}
+	return token, nil
+}
+
+// parse verifies the signature, issuer and expiry of a token and that it is
+// meant for use.
+func (s *Sessions) parse(token, use string) (*claims, error) {
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, func(*jwt.Token) (interface{}, error) {
+		return s.cfg.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(s.cfg.Issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, apperrors.Unauthorized("invalid_token", "invalid %s token", use).Wrap(err)
+	}
+	if c.TokenUse != use {
+		return nil, apperrors.Unauthorized("invalid_token", "not an %s token", use)
+	}
+	return &c, nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", apperrors.Validation("invalid_email", "email %q is not a valid address", email)
+	}
+	return email, nil
+}
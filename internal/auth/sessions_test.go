@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memoryUsers keeps users and sessions the way UserRepository does.
+type memoryUsers struct {
+	user     models.User
+	hash     string
+	sessions map[string]*models.Session
+	// tokens maps refresh token IDs to their session, used marks spent ones.
+	tokens map[string]string
+	used   map[string]bool
+}
+
+func newMemoryUsers(t *testing.T, email, password string) *memoryUsers {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &memoryUsers{
+		user:     models.User{ID: 7, Email: email, Role: models.RoleEditor},
+		hash:     string(hash),
+		sessions: make(map[string]*models.Session),
+		tokens:   make(map[string]string),
+		used:     make(map[string]bool),
+	}
+}
+
+func (m *memoryUsers) CreateUser(ctx context.Context, user *models.User, passwordHash string) error {
+	return apperrors.Conflict("email_taken", "email is taken")
+}
+
+func (m *memoryUsers) GetUserByEmail(ctx context.Context, email string) (*models.User, string, error) {
+	if email != m.user.Email {
+		return nil, "", apperrors.NotFound("user_not_found", "no user")
+	}
+	user := m.user
+	return &user, m.hash, nil
+}
+
+func (m *memoryUsers) CreateSession(ctx context.Context, session *models.Session, tokenID string, expiresAt time.Time) error {
+	session.Role = m.user.Role
+	m.sessions[session.ID] = session
+	m.tokens[tokenID] = session.ID
+	return nil
+}
+
+func (m *memoryUsers) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, apperrors.NotFound("session_not_found", "no session")
+	}
+	return session, nil
+}
+
+func (m *memoryUsers) RotateRefreshToken(ctx context.Context, tokenID, newTokenID string, expiresAt time.Time) (*models.Session, error) {
+	session, ok := m.sessions[m.tokens[tokenID]]
+	if !ok || session.RevokedAt != nil {
+		return nil, apperrors.NotFound("refresh_token_not_found", "refresh token is unknown, expired or revoked")
+	}
+	if m.used[tokenID] {
+		now := time.Now()
+		session.RevokedAt = &now
+		return nil, apperrors.Conflict("refresh_token_reused", "refresh token was already used")
+	}
+	m.used[tokenID] = true
+	m.tokens[newTokenID] = session.ID
+	return session, nil
+}
+
+func (m *memoryUsers) RevokeSession(ctx context.Context, id string) error {
+	if session, ok := m.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func errorCode(err error) string {
+	if appErr, ok := apperrors.As(err); ok {
+		return appErr.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func TestSessionsRefresh(t *testing.T) {
+	creds := models.Credentials{Email: "ann@example.com", Password: "correct horse"}
+
+	// Each case logs in and refreshes once, then uses the tokens as told.
+	tests := []struct {
+		name string
+		// use returns the error of the call under test, given the pair from
+		// the login and the one from the first refresh.
+		use  func(s *Sessions, login, refreshed *models.TokenPair) error
+		want string
+	}{
+		{
+			name: "rotated token works",
+			use: func(s *Sessions, login, refreshed *models.TokenPair) error {
+				_, err := s.Refresh(context.Background(), refreshed.RefreshToken)
+				return err
+			},
+		},
+		{
+			name: "reused token is refused",
+			use: func(s *Sessions, login, refreshed *models.TokenPair) error {
+				_, err := s.Refresh(context.Background(), login.RefreshToken)
+				return err
+			},
+			want: "refresh_token_reused",
+		},
+		{
+			name: "reuse ends the session for the rotated token",
+			use: func(s *Sessions, login, refreshed *models.TokenPair) error {
+				s.Refresh(context.Background(), login.RefreshToken)
+				_, err := s.Refresh(context.Background(), refreshed.RefreshToken)
+				return err
+			},
+			want: "invalid_refresh_token",
+		},
+		{
+			name: "reuse ends the session for access tokens",
+			use: func(s *Sessions, login, refreshed *models.TokenPair) error {
+				s.Refresh(context.Background(), login.RefreshToken)
+				_, err := s.Authenticate(context.Background(), refreshed.AccessToken)
+				return err
+			},
+			want: "session_revoked",
+		},
+		{
+			name: "access token is no refresh token",
+			use: func(s *Sessions, login, refreshed *models.TokenPair) error {
+				_, err := s.Refresh(context.Background(), refreshed.AccessToken)
+				return err
+			},
+			want: "invalid_token",
+		},
+		{
+			name: "logged out session cannot refresh",
+			use: func(s *Sessions, login, refreshed *models.TokenPair) error {
+				if err := s.Logout(context.Background(), refreshed.RefreshToken); err != nil {
+					return err
+				}
+				_, err := s.Refresh(context.Background(), refreshed.RefreshToken)
+				return err
+			},
+			want: "invalid_refresh_token",
+		},
+		{
+			name: "token of another secret",
+			use: func(s *Sessions, login, refreshed *models.TokenPair) error {
+				other := NewSessions(s.store, SessionConfig{Secret: []byte("other secret")})
+				_, err := other.Refresh(context.Background(), refreshed.RefreshToken)
+				return err
+			},
+			want: "invalid_token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSessions(newMemoryUsers(t, creds.Email, creds.Password), SessionConfig{Secret: []byte("test secret")})
+
+			login, err := s.Login(context.Background(), creds)
+			if err != nil {
+				t.Fatalf("login: %v", err)
+			}
+			refreshed, err := s.Refresh(context.Background(), login.RefreshToken)
+			if err != nil {
+				t.Fatalf("first refresh: %v", err)
+			}
+
+			if got := errorCode(tt.use(s, login, refreshed)); got != tt.want {
+				t.Errorf("error = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionsAuthenticate(t *testing.T) {
+	creds := models.Credentials{Email: "ann@example.com", Password: "correct horse"}
+	s := NewSessions(newMemoryUsers(t, creds.Email, creds.Password), SessionConfig{Secret: []byte("test secret")})
+
+	pair, err := s.Login(context.Background(), creds)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	identity, err := s.Authenticate(context.Background(), pair.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if identity.ID != 7 || identity.Role != models.RoleEditor || identity.Name != creds.Email {
+		t.Errorf("identity = %+v", identity)
+	}
+
+	if _, err := s.Login(context.Background(), models.Credentials{Email: creds.Email, Password: "wrong"}); errorCode(err) != "invalid_credentials" {
+		t.Errorf("wrong password: error = %v", err)
+	}
+}
@@ -1,10 +1,15 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/KarmaBeLike/SongLibrary/config"
 
@@ -15,17 +20,36 @@ import (
 	"github.com/pkg/errors"
 )
 
-func OpenDB(cfg *config.Config) (*sql.DB, error) {
-	dbURL := fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName)
+// DSN returns the connection string for the configured database.
+func DSN(cfg *config.Config) string {
+	return fmt.Sprintf("host=%s port=%d user=%s "+
+		"password=%s dbname=%s sslmode=disable connect_timeout=%d",
+		quote(cfg.DBHost), cfg.DBPort, quote(cfg.DBUser), quote(cfg.DBPassword), quote(cfg.DBName),
+		int(math.Ceil(cfg.DBConnectTimeout.Seconds())))
+}
+
+// quote escapes a value for the key=value connection string, passwords read
+// from files may contain spaces and quotes.
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
 
-	db, err := sql.Open("postgres", dbURL)
+func OpenDB(cfg *config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", DSN(cfg))
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to connect to the database:")
 	}
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
 
-	if err := db.Ping(); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DBConnectTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, errors.Wrap(err, "Database ping failed")
 	}
 
@@ -33,6 +57,9 @@ func OpenDB(cfg *config.Config) (*sql.DB, error) {
 	return db, nil
 }
 
+// MigrationsDir holds the numbered migration files.
+const MigrationsDir = "migrations"
+
 func RunMigrations(db *sql.DB) error {
 	driver, err := postgres.WithInstance(db, &postgres.Config{})
 	if err != nil {
@@ -40,7 +67,7 @@ func RunMigrations(db *sql.DB) error {
 	}
 
 	m, err := migrate.NewWithDatabaseInstance(
-		"file://migrations",
+		"file://"+MigrationsDir,
 		"postgres", driver)
 	if err != nil {
 		return errors.Wrap(err, "migrate")
@@ -54,6 +81,38 @@ func RunMigrations(db *sql.DB) error {
 	return nil
 }
 
+// LatestMigration returns the version of the newest migration in dir.
+func LatestMigration(dir string) (uint, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return 0, errors.Wrap(err, "list migrations")
+	}
+
+	var latest uint
+	for _, file := range files {
+		prefix, _, _ := strings.Cut(filepath.Base(file), "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s is not numbered: %w", file, err)
+		}
+		latest = max(latest, uint(version))
+	}
+	if latest == 0 {
+		return 0, fmt.Errorf("no migrations found in %s", dir)
+	}
+	return latest, nil
+}
+
+// MigrationVersion returns the version the database was migrated to. Dirty
+// means the last migration failed halfway.
+func MigrationVersion(ctx context.Context, db *sql.DB) (version uint, dirty bool, err error) {
+	err = db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return version, dirty, errors.Wrap(err, "fetch migration version")
+}
+
 func LoadTestData(db *sql.DB, filePath string) error {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
@@ -0,0 +1,184 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	JobStorage interface {
+		GetJobByID(ctx context.Context, id int) (*models.EnrichmentJob, error)
+		ClaimJob(ctx context.Context, owner string, lease time.Duration) (*models.EnrichmentJob, error)
+		CompleteJob(ctx context.Context, id int, owner string) error
+		RetryJob(ctx context.Context, id int, owner string, nextAttempt time.Time, lastError string) error
+		FailJob(ctx context.Context, id, songID int, owner, lastError string) error
+	}
+
+	Enricher interface {
+		EnrichSong(ctx context.Context, id int) error
+	}
+
+	Config struct {
+		Workers      int
+		PollInterval time.Duration
+		// Lease is how long a claimed job belongs to a worker. It must be longer
+		// than one enrichment attempt, after that the job is taken again.
+		Lease time.Duration
+		// RetryDelay is the pause after the first failed attempt, it doubles
+		// with every further attempt up to MaxRetryDelay.
+		RetryDelay    time.Duration
+		MaxRetryDelay time.Duration
+	}
+
+	// Pool runs background workers that fetch details for pending songs.
+	Pool struct {
+		jobs     JobStorage
+		enricher Enricher
+		cfg      Config
+		// id tells the leases of this pool apart from those of other instances.
+		id string
+		wg sync.WaitGroup
+	}
+)
+
+func NewPool(jobs JobStorage, enricher Enricher, cfg Config) *Pool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 2 * time.Minute
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = 30 * time.Second
+	}
+	if cfg.MaxRetryDelay <= 0 {
+		cfg.MaxRetryDelay = time.Hour
+	}
+
+	return &Pool{
+		jobs:     jobs,
+		enricher: enricher,
+		cfg:      cfg,
+		id:       fmt.Sprintf("%016x", rand.Uint64()),
+	}
+}
+
+// Start launches the workers. They stop when ctx is cancelled, Wait blocks
+// until they have.
+func (p *Pool) Start(ctx context.Context) {
+	slog.Info("Starting enrichment workers", slog.Int("workers", p.cfg.Workers))
+
+	for i := 0; i < p.cfg.Workers; i++ {
+		owner := fmt.Sprintf("%s-%d", p.id, i)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.run(ctx, owner)
+		}()
+	}
+}
+
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+func (p *Pool) GetJob(ctx context.Context, id int) (*models.EnrichmentJob, error) {
+	return p.jobs.GetJobByID(ctx, id)
+}
+
+func (p *Pool) run(ctx context.Context, owner string) {
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before waiting for the next tick.
+		for ctx.Err() == nil && p.processNext(ctx, owner) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNext handles one job and reports whether there was one.
+func (p *Pool) processNext(ctx context.Context, owner string) bool {
+	job, err := p.jobs.ClaimJob(ctx, owner, p.cfg.Lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to claim enrichment job", slog.Any("error", err))
+		}
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	logger := slog.With(slog.Int("job_id", job.ID), slog.Int("song_id", job.SongID), slog.Int("attempt", job.Attempts))
+	logger.Debug("Processing enrichment job")
+
+	attemptCtx, cancel := context.WithTimeout(logging.WithLogger(ctx, logger), p.cfg.Lease)
+	err = p.enricher.EnrichSong(attemptCtx, job.SongID)
+	cancel()
+
+	// Use a fresh context so the outcome is stored even during shutdown.
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	var storeErr error
+	switch {
+	case err == nil:
+		logger.Info("Enrichment job succeeded")
+		storeErr = p.jobs.CompleteJob(storeCtx, job.ID, owner)
+	case job.Attempts >= job.MaxAttempts || isPermanent(err):
+		logger.Warn("Enrichment job failed", slog.Any("error", err))
+		storeErr = p.jobs.FailJob(storeCtx, job.ID, job.SongID, owner, err.Error())
+	default:
+		next := time.Now().Add(p.retryDelay(job.Attempts))
+		logger.Warn("Enrichment job failed, will retry", slog.Time("next_attempt_at", next), slog.Any("error", err))
+		storeErr = p.jobs.RetryJob(storeCtx, job.ID, owner, next, err.Error())
+	}
+
+	switch {
+	case errors.Is(storeErr, apperrors.ErrConflict):
+		// The lease ran out, the job is or will be run again and its outcome
+		// stored by that attempt.
+		logger.Warn("Enrichment job lease lost, outcome dropped", slog.Any("error", storeErr))
+	case storeErr != nil:
+		logger.Error("Failed to store enrichment job outcome", slog.Any("error", storeErr))
+	}
+
+	return true
+}
+
+// retryDelay is the pause after the given number of attempts: RetryDelay
+// doubled for every attempt after the first, at most MaxRetryDelay.
+func (p *Pool) retryDelay(attempts int) time.Duration {
+	delay := p.cfg.RetryDelay
+	for i := 1; i < attempts && delay < p.cfg.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.cfg.MaxRetryDelay)
+}
+
+// isPermanent reports errors that another attempt would not fix.
+func isPermanent(err error) bool {
+	return errors.Is(err, apperrors.ErrNotFound) ||
+		errors.Is(err, apperrors.ErrValidation) ||
+		errors.Is(err, apperrors.ErrConflict) ||
+		errors.Is(err, apperrors.ErrUpstreamRejected)
+}
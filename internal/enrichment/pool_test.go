@@ -0,0 +1,184 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+// memoryJobs leases jobs the way JobRepository does, on a clock of its own.
+type memoryJobs struct {
+	JobStorage
+	now  time.Time
+	jobs []*memoryJob
+	// refused lists the workers whose outcome came after their lease.
+	refused []string
+}
+
+type memoryJob struct {
+	models.EnrichmentJob
+	lockedBy    string
+	lockedUntil time.Time
+	// completedBy names the worker whose outcome was stored.
+	completedBy string
+}
+
+func (m *memoryJobs) ClaimJob(ctx context.Context, owner string, lease time.Duration) (*models.EnrichmentJob, error) {
+	for _, job := range m.jobs {
+		due := job.Status == models.JobStatusQueued && !job.NextAttemptAt.After(m.now)
+		expired := job.Status == models.JobStatusRunning && job.lockedUntil.Before(m.now)
+		if due || expired {
+			job.Status = models.JobStatusRunning
+			job.Attempts++
+			job.lockedBy, job.lockedUntil = owner, m.now.Add(lease)
+			claimed := job.EnrichmentJob
+			return &claimed, nil
+		}
+	}
+	return nil, nil
+}
+
+// release ends the lease of owner on the job, or returns a conflict if owner
+// no longer holds it.
+func (m *memoryJobs) release(id int, owner string) (*memoryJob, error) {
+	for _, job := range m.jobs {
+		if job.ID == id && job.lockedBy == owner && job.lockedUntil.After(m.now) {
+			job.lockedBy, job.completedBy = "", owner
+			return job, nil
+		}
+	}
+	m.refused = append(m.refused, owner)
+	return nil, apperrors.Conflict("lease_lost", "job %d is no longer leased to this worker", id)
+}
+
+func (m *memoryJobs) CompleteJob(ctx context.Context, id int, owner string) error {
+	job, err := m.release(id, owner)
+	if err == nil {
+		job.Status = models.JobStatusSucceeded
+	}
+	return err
+}
+
+func (m *memoryJobs) RetryJob(ctx context.Context, id int, owner string, nextAttempt time.Time, lastError string) error {
+	job, err := m.release(id, owner)
+	if err == nil {
+		job.Status, job.NextAttemptAt, job.LastError = models.JobStatusQueued, nextAttempt, &lastError
+	}
+	return err
+}
+
+func (m *memoryJobs) FailJob(ctx context.Context, id, songID int, owner, lastError string) error {
+	job, err := m.release(id, owner)
+	if err == nil {
+		job.Status, job.LastError = models.JobStatusFailed, &lastError
+	}
+	return err
+}
+
+type enricherFunc func(ctx context.Context, id int) error
+
+func (f enricherFunc) EnrichSong(ctx context.Context, id int) error {
+	return f(ctx, id)
+}
+
+func newMemoryJobs(maxAttempts int) *memoryJobs {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return &memoryJobs{
+		now: now,
+		jobs: []*memoryJob{{EnrichmentJob: models.EnrichmentJob{
+			ID: 1, SongID: 10, Status: models.JobStatusQueued, MaxAttempts: maxAttempts, NextAttemptAt: now,
+		}}},
+	}
+}
+
+func TestPoolOutcomes(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		maxAttempts int
+		status      string
+	}{
+		{"success", nil, 3, models.JobStatusSucceeded},
+		{"transient error is retried", apperrors.UpstreamUnavailable("upstream_unavailable", "provider is down"), 3, models.JobStatusQueued},
+		{"unknown error is retried", errors.New("connection reset"), 3, models.JobStatusQueued},
+		{"last attempt fails", errors.New("connection reset"), 1, models.JobStatusFailed},
+		{"not found is permanent", apperrors.NotFound("song_detail_not_found", "no details"), 3, models.JobStatusFailed},
+		{"invalid lyrics are permanent", apperrors.Validation("invalid_lyrics", "bad text"), 3, models.JobStatusFailed},
+		{"rejected request is permanent", apperrors.UpstreamRejected("upstream_rejected", "status 400"), 3, models.JobStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := newMemoryJobs(tt.maxAttempts)
+			calls := 0
+			p := NewPool(jobs, enricherFunc(func(ctx context.Context, id int) error {
+				calls++
+				return tt.err
+			}), Config{RetryDelay: time.Minute})
+
+			if !p.processNext(context.Background(), "worker") {
+				t.Fatal("no job claimed")
+			}
+			job := jobs.jobs[0]
+			if job.Status != tt.status || calls != 1 {
+				t.Fatalf("status = %s after %d attempts, want %s after 1", job.Status, calls, tt.status)
+			}
+			// The pool schedules retries on the wall clock.
+			if wait := time.Until(job.NextAttemptAt); tt.status == models.JobStatusQueued && wait < 50*time.Second {
+				t.Errorf("retry in %s, want a minute", wait)
+			}
+
+			// A failed or finished job is never claimed again.
+			if tt.status != models.JobStatusQueued && p.processNext(context.Background(), "worker") {
+				t.Errorf("%s job claimed again", job.Status)
+			}
+		})
+	}
+}
+
+func TestPoolReclaimsExpiredLease(t *testing.T) {
+	jobs := newMemoryJobs(3)
+	lease := time.Minute
+	var p *Pool
+
+	attempts := 0
+	p = NewPool(jobs, enricherFunc(func(ctx context.Context, id int) error {
+		attempts++
+		if attempts == 1 {
+			// The first worker stalls past its lease, a second one takes the job over.
+			jobs.now = jobs.now.Add(2 * lease)
+			if !p.processNext(context.Background(), "fresh") {
+				t.Error("expired job not reclaimed")
+			}
+		}
+		return nil
+	}), Config{Lease: lease})
+
+	p.processNext(context.Background(), "stale")
+
+	job := jobs.jobs[0]
+	if job.Status != models.JobStatusSucceeded || job.Attempts != 2 {
+		t.Errorf("status = %s after %d attempts", job.Status, job.Attempts)
+	}
+	if job.completedBy != "fresh" {
+		t.Errorf("outcome stored by %q, want the worker holding the lease", job.completedBy)
+	}
+	if !slices.Equal(jobs.refused, []string{"stale"}) {
+		t.Errorf("refused outcomes of %v, want the stale worker's", jobs.refused)
+	}
+}
+
+func TestPoolRetryDelay(t *testing.T) {
+	p := NewPool(nil, nil, Config{RetryDelay: time.Second, MaxRetryDelay: 5 * time.Second})
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 60: 5 * time.Second} {
+		if got := p.retryDelay(attempts); got != want {
+			t.Errorf("retryDelay(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package feed
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	Config struct {
+		// Retain is how many recent events are kept for clients resuming
+		// with Last-Event-ID.
+		Retain int
+		// ClientBuffer is how many events may wait for a slow client before
+		// it is disconnected.
+		ClientBuffer int
+	}
+
+	// Filter selects the events a client wants, empty fields match everything.
+	Filter struct {
+		Group string
+		Types []string
+	}
+
+	// Subscription delivers events to one client. Events is closed when the
+	// broker shuts down or the client fell too far behind.
+	Subscription struct {
+		Events <-chan models.Event
+		events chan models.Event
+		filter Filter
+	}
+
+	// Broker fans change events out to connected clients and keeps a window
+	// of recent events to replay.
+	Broker struct {
+		mu      sync.Mutex
+		cfg     Config
+		recent  []models.Event
+		seen    map[string]struct{}
+		clients map[*Subscription]struct{}
+		closed  bool
+	}
+)
+
+func NewBroker(cfg Config) *Broker {
+	if cfg.Retain <= 0 {
+		cfg.Retain = 1000
+	}
+	if cfg.ClientBuffer <= 0 {
+		cfg.ClientBuffer = 64
+	}
+
+	return &Broker{
+		cfg:     cfg,
+		seen:    make(map[string]struct{}),
+		clients: make(map[*Subscription]struct{}),
+	}
+}
+
+func (f Filter) Match(event models.Event) bool {
+	if f.Group != "" && f.Group != event.Group {
+		return false
+	}
+	return len(f.Types) == 0 || slices.Contains(f.Types, event.Type)
+}
+
+// Publish sends the event to every matching client. Events already seen, as
+// redelivered by the outbox, are dropped.
+func (b *Broker) Publish(_ context.Context, event models.Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	if _, ok := b.seen[event.ID]; ok {
+		return nil
+	}
+
+	if len(b.recent) == b.cfg.Retain {
+		delete(b.seen, b.recent[0].ID)
+		b.recent = append(b.recent[:0], b.recent[1:]...)
+	}
+	b.recent = append(b.recent, event)
+	b.seen[event.ID] = struct{}{}
+
+	for sub := range b.clients {
+		if !sub.filter.Match(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// The client reconnects with Last-Event-ID and catches up from the window.
+			slog.Warn("Dropping slow event stream client", slog.String("event_id", event.ID))
+			b.remove(sub)
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a client. With a lastEventID it also returns the
+// matching events after that one; resumed is false if the ID is no longer
+// in the window, in which case the client missed events.
+func (b *Broker) Subscribe(filter Filter, lastEventID string) (sub *Subscription, replay []models.Event, resumed bool) {
+	events := make(chan models.Event, b.cfg.ClientBuffer)
+	sub = &Subscription{Events: events, events: events, filter: filter}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(events)
+		return sub, nil, false
+	}
+	b.clients[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+	for i, event := range b.recent {
+		if event.ID != lastEventID {
+			continue
+		}
+		for _, next := range b.recent[i+1:] {
+			if filter.Match(next) {
+				replay = append(replay, next)
+			}
+		}
+		return sub, replay, true
+	}
+	return sub, nil, false
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(sub)
+}
+
+// Close ends all subscriptions. Clients finish writing the event they are on
+// and then see their channel closed.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for sub := range b.clients {
+		b.remove(sub)
+	}
+	slog.Info("Event feed closed")
+}
+
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.clients[sub]; !ok {
+		return
+	}
+	delete(b.clients, sub)
+	close(sub.events)
+}
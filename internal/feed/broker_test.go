@@ -0,0 +1,128 @@
+package feed
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+func ids(events []models.Event) []string {
+	var ids []string
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+// drain returns the events waiting on the subscription without blocking.
+func drain(sub *Subscription) []models.Event {
+	var events []models.Event
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestBrokerSubscribeReplay(t *testing.T) {
+	published := []models.Event{
+		{ID: "1", Type: models.EventSongCreated, Group: "Muse"},
+		{ID: "2", Type: models.EventSongUpdated, Group: "Muse"},
+		{ID: "3", Type: models.EventSongCreated, Group: "Queen"},
+		{ID: "4", Type: models.EventSongDeleted, Group: "Muse"},
+	}
+
+	tests := []struct {
+		name        string
+		retain      int
+		filter      Filter
+		lastEventID string
+		wantReplay  []string
+		wantResumed bool
+	}{
+		{name: "no last event id", retain: 10, wantResumed: true},
+		{name: "replays after the last event", retain: 10, lastEventID: "2", wantReplay: []string{"3", "4"}, wantResumed: true},
+		{name: "up to date", retain: 10, lastEventID: "4", wantResumed: true},
+		{name: "replay is filtered by group", retain: 10, filter: Filter{Group: "Muse"}, lastEventID: "1", wantReplay: []string{"2", "4"}, wantResumed: true},
+		{name: "replay is filtered by type", retain: 10, filter: Filter{Types: []string{models.EventSongCreated}}, lastEventID: "1", wantReplay: []string{"3"}, wantResumed: true},
+		{name: "unknown id", retain: 10, lastEventID: "missing", wantResumed: false},
+		{name: "id left the window", retain: 2, lastEventID: "1", wantResumed: false},
+		{name: "oldest id in the window", retain: 2, lastEventID: "3", wantReplay: []string{"4"}, wantResumed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBroker(Config{Retain: tt.retain, ClientBuffer: 10})
+			for _, event := range published {
+				b.Publish(context.Background(), event)
+			}
+
+			sub, replay, resumed := b.Subscribe(tt.filter, tt.lastEventID)
+			defer b.Unsubscribe(sub)
+
+			if got := ids(replay); !slices.Equal(got, tt.wantReplay) {
+				t.Errorf("replay = %v, want %v", got, tt.wantReplay)
+			}
+			if resumed != tt.wantResumed {
+				t.Errorf("resumed = %v, want %v", resumed, tt.wantResumed)
+			}
+		})
+	}
+}
+
+func TestBrokerPublish(t *testing.T) {
+	b := NewBroker(Config{Retain: 10, ClientBuffer: 10})
+	all, _, _ := b.Subscribe(Filter{}, "")
+	muse, _, _ := b.Subscribe(Filter{Group: "Muse"}, "")
+
+	b.Publish(context.Background(), models.Event{ID: "1", Group: "Muse"})
+	b.Publish(context.Background(), models.Event{ID: "2", Group: "Queen"})
+	// Redelivered by the outbox.
+	b.Publish(context.Background(), models.Event{ID: "1", Group: "Muse"})
+
+	if got, want := ids(drain(all)), []string{"1", "2"}; !slices.Equal(got, want) {
+		t.Errorf("all: got %v, want %v", got, want)
+	}
+	if got, want := ids(drain(muse)), []string{"1"}; !slices.Equal(got, want) {
+		t.Errorf("muse: got %v, want %v", got, want)
+	}
+}
+
+func TestBrokerDropsSlowClient(t *testing.T) {
+	b := NewBroker(Config{Retain: 10, ClientBuffer: 1})
+	sub, _, _ := b.Subscribe(Filter{}, "")
+
+	b.Publish(context.Background(), models.Event{ID: "1"})
+	b.Publish(context.Background(), models.Event{ID: "2"})
+
+	if got := ids(drain(sub)); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("got %v, want [1]", got)
+	}
+	if _, ok := <-sub.Events; ok {
+		t.Error("events of a dropped client are not closed")
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker(Config{})
+	sub, _, _ := b.Subscribe(Filter{}, "")
+
+	b.Close()
+	if _, ok := <-sub.Events; ok {
+		t.Error("events are not closed after Close")
+	}
+
+	late, _, resumed := b.Subscribe(Filter{}, "")
+	if _, ok := <-late.Events; ok || resumed {
+		t.Errorf("subscription after Close: open = %v, resumed = %v", ok, resumed)
+	}
+	b.Unsubscribe(sub)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	Breaker interface {
+		Status() models.BreakerStatus
+	}
+	Cache interface {
+		Stats() models.CacheStats
+	}
+	AdminClient struct {
+		breakers []Breaker
+		caches   []Cache
+	}
+)
+
+func NewAdminClient(breakers []Breaker, caches []Cache) *AdminClient {
+	return &AdminClient{
+		breakers: breakers,
+		caches:   caches,
+	}
+}
+
+// GetBreakers reports the state of the circuit breakers around external providers.
+// @Summary Get circuit breaker states
+// @Description Returns the state, request and failure counts of every external provider circuit breaker.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.BreakerStatus "Successful operation"
+// @Router /api/admin/breakers [get]
+func (c *AdminClient) GetBreakers(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]models.BreakerStatus, 0, len(c.breakers))
+	for _, b := range c.breakers {
+		statuses = append(statuses, b.Status())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
+	}
+}
+
+// GetCaches reports hit and miss counters of the song detail caches.
+// @Summary Get song detail cache statistics
+// @Description Returns size, hit, miss and eviction counters of every song detail cache.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.CacheStats "Successful operation"
+// @Router /api/admin/caches [get]
+func (c *AdminClient) GetCaches(w http.ResponseWriter, r *http.Request) {
+	stats := make([]models.CacheStats, 0, len(c.caches))
+	for _, cache := range c.caches {
+		stats = append(stats, cache.Stats())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	apiKeyService interface {
+		Create(ctx context.Context, req models.NewAPIKeyRequest) (*models.CreatedAPIKey, error)
+		List(ctx context.Context) ([]models.APIKey, error)
+		Revoke(ctx context.Context, id int) error
+	}
+	APIKeyClient struct {
+		service apiKeyService
+	}
+)
+
+func NewAPIKeyClient(service apiKeyService) *APIKeyClient {
+	return &APIKeyClient{
+		service: service,
+	}
+}
+
+// CreateAPIKey issues a new API key.
+// @Summary Create an API key
+// @Description Issues a key with the given scopes. A key acts as a viewer with read, an editor with write and an admin with admin.
+// @Description The key is only returned in this response, send it as X-API-Key or "Authorization: Bearer <key>".
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param key body models.NewAPIKeyRequest true "Key name and scopes"
+// @Success 201 {object} models.CreatedAPIKey "Key created"
+// @Failure 400 {object} Problem "Missing name or invalid scope"
+// @Failure 401 {object} Problem "Authentication required"
+// @Failure 403 {object} Problem "Admin role required"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/admin/api-keys [post]
+func (c *APIKeyClient) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req models.NewAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, apperrors.Validation("invalid_payload", "invalid request payload").Wrap(err))
+		return
+	}
+
+	key, err := c.service.Create(r.Context(), req)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to create api key", slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// GetAPIKeys lists the API keys without the keys themselves.
+// @Summary List API keys
+// @Tags auth
+// @Produce json
+// @Success 200 {array} models.APIKey "Successful operation"
+// @Failure 401 {object} Problem "Authentication required"
+// @Failure 403 {object} Problem "Admin role required"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/admin/api-keys [get]
+func (c *APIKeyClient) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := c.service.List(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to list api keys", slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(keys); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
+	}
+}
+
+// RevokeAPIKey revokes an API key.
+// @Summary Revoke an API key
+// @Tags auth
+// @Produce json
+// @Param id query int true "Key ID"
+// @Success 200 {object} map[string]interface{} "Key revoked"
+// @Failure 400 {object} Problem "Invalid key ID"
+// @Failure 401 {object} Problem "Authentication required"
+// @Failure 403 {object} Problem "Admin role required"
+// @Failure 404 {object} Problem "Key not found or already revoked"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/admin/api-keys [delete]
+func (c *APIKeyClient) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		writeError(w, r, apperrors.Validation("invalid_key_id", "id must be a positive integer"))
+		return
+	}
+
+	if err := c.service.Revoke(r.Context(), id); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to revoke api key", slog.Int("key_id", id), slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "API key revoked",
+		"id":      id,
+	})
+}
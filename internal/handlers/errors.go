@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/auth"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/middleware"
+)
+
+// Problem is an RFC 7807 error response body.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func statusFor(err error) (int, string) {
+	switch {
+	case errors.Is(err, apperrors.ErrValidation):
+		return http.StatusBadRequest, "validation_failed"
+	case errors.Is(err, apperrors.ErrUnauthorized):
+		return http.StatusUnauthorized, "unauthorized"
+	case errors.Is(err, apperrors.ErrForbidden):
+		return http.StatusForbidden, "forbidden"
+	case errors.Is(err, apperrors.ErrNotFound):
+		return http.StatusNotFound, "not_found"
+	case errors.Is(err, apperrors.ErrConflict):
+		return http.StatusConflict, "conflict"
+	case errors.Is(err, apperrors.ErrRateLimited):
+		return http.StatusTooManyRequests, "rate_limited"
+	case errors.Is(err, apperrors.ErrUpstreamUnavailable):
+		return http.StatusServiceUnavailable, "upstream_unavailable"
+	case errors.Is(err, apperrors.ErrUpstreamRejected):
+		return http.StatusBadGateway, "upstream_rejected"
+	default:
+		return http.StatusInternalServerError, "internal_error"
+	}
+}
+
+// WriteError lets middleware outside this package answer with a problem response.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, err)
+}
+
+// writeError maps err to a status code and writes it as application/problem+json.
+// Details of internal errors are not exposed to the client.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := statusFor(err)
+
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: middleware.RequestIDFromContext(r.Context()),
+	}
+
+	if appErr, ok := apperrors.As(err); ok {
+		problem.Code = appErr.Code
+		problem.Detail = appErr.Message
+	}
+
+	if status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Error("Request failed", slog.String("code", problem.Code),
+			slog.Any("identity", auth.IdentityFromContext(r.Context())), slog.Any("error", err))
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode problem response", slog.Any("error", err))
+	}
+}
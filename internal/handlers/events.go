@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/feed"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	eventBroker interface {
+		Subscribe(filter feed.Filter, lastEventID string) (*feed.Subscription, []models.Event, bool)
+		Unsubscribe(sub *feed.Subscription)
+	}
+	EventClient struct {
+		broker    eventBroker
+		heartbeat time.Duration
+	}
+)
+
+func NewEventClient(broker eventBroker) *EventClient {
+	return &EventClient{
+		broker:    broker,
+		heartbeat: 15 * time.Second,
+	}
+}
+
+// StreamEvents streams song and group changes as Server-Sent Events.
+// @Summary Stream change events
+// @Description Streams song.created, song.updated, song.deleted and group.created events as text/event-stream.
+// @Description Each event carries its ID; reconnecting with Last-Event-ID replays what was missed from a window of recent events.
+// @Description If the ID is no longer in the window a "reset" event is sent first and the client should reload its data.
+// @Tags events
+// @Produce text/event-stream
+// @Param group query string false "Only events of this group" example("Muse")
+// @Param type query string false "Comma-separated event types" example("song.created,song.updated")
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} Problem "Invalid event type"
+// @Router /api/events [get]
+func (c *EventClient) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	filter := feed.Filter{Group: r.URL.Query().Get("group")}
+	if types := r.URL.Query().Get("type"); types != "" {
+		for _, eventType := range strings.Split(types, ",") {
+			eventType = strings.TrimSpace(eventType)
+			if !slices.Contains(models.EventTypes, eventType) {
+				writeError(w, r, apperrors.Validation("invalid_event_type", "unknown event type %q, expected one of %v", eventType, models.EventTypes))
+				return
+			}
+			filter.Types = append(filter.Types, eventType)
+		}
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	sub, replay, resumed := c.broker.Subscribe(filter, lastEventID)
+	defer c.broker.Unsubscribe(sub)
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the read and write timeouts of the server. An
+	// expired read deadline would cancel the request context.
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	logging.FromContext(r.Context()).Info("Event stream opened", slog.String("group", filter.Group), slog.Any("types", filter.Types), slog.String("last_event_id", lastEventID))
+	defer logging.FromContext(r.Context()).Info("Event stream closed")
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !resumed {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range replay {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		logging.FromContext(r.Context()).Error("Event stream not supported by the connection", slog.Any("error", err))
+		return
+	}
+
+	heartbeat := time.NewTicker(c.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	readinessChecker interface {
+		Ready(ctx context.Context) models.Readiness
+	}
+	HealthClient struct {
+		checker readinessChecker
+	}
+)
+
+func NewHealthClient(checker readinessChecker) *HealthClient {
+	return &HealthClient{
+		checker: checker,
+	}
+}
+
+// Live tells that the process is up.
+// @Summary Liveness probe
+// @Description Answers as long as the process serves HTTP, dependencies are not checked.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Alive"
+// @Router /healthz [get]
+func (c *HealthClient) Live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready tells whether the service can serve requests.
+// @Summary Readiness probe
+// @Description Checks the database, its migration version and, when enabled, the song detail providers. Reports not ready while shutting down.
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.Readiness "Ready"
+// @Failure 503 {object} models.Readiness "Not ready or shutting down"
+// @Router /readyz [get]
+func (c *HealthClient) Ready(w http.ResponseWriter, r *http.Request) {
+	readiness := c.checker.Ready(r.Context())
+
+	status := http.StatusOK
+	if readiness.Status != models.HealthReady {
+		logging.FromContext(r.Context()).Warn("Service not ready", slog.String("status", readiness.Status), slog.Any("checks", readiness.Checks))
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, r, status, readiness)
+}
+
+func writeHealth(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
+	}
+}
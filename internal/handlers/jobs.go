@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	jobService interface {
+		GetJob(ctx context.Context, id int) (*models.EnrichmentJob, error)
+	}
+	JobClient struct {
+		service jobService
+	}
+)
+
+func NewJobClient(service jobService) *JobClient {
+	return &JobClient{
+		service: service,
+	}
+}
+
+// GetJob returns the status of a background enrichment job.
+// @Summary Get enrichment job status
+// @Description Returns the status, attempt count and last error of a job fetching song details.
+// @Tags jobs
+// @Produce json
+// @Param id query int true "Job ID" example(1)
+// @Success 200 {object} models.EnrichmentJob "Successful operation"
+// @Failure 400 {object} Problem "Invalid job ID"
+// @Failure 404 {object} Problem "Job not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/jobs [get]
+func (c *JobClient) GetJob(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+
+	if err != nil || id <= 0 {
+		logging.FromContext(r.Context()).Warn("Invalid job ID received", slog.String("id", idStr))
+		writeError(w, r, apperrors.Validation("invalid_job_id", "id must be a positive integer"))
+		return
+	}
+
+	job, err := c.service.GetJob(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to fetch job", slog.Int("job_id", id), slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	roleService interface {
+		ListUsers(ctx context.Context) ([]models.User, error)
+		Assign(ctx context.Context, userID int, role string) (*models.User, error)
+	}
+	RoleClient struct {
+		service roleService
+	}
+)
+
+func NewRoleClient(service roleService) *RoleClient {
+	return &RoleClient{
+		service: service,
+	}
+}
+
+// GetUsers lists the users with their roles.
+// @Summary List users
+// @Tags auth
+// @Produce json
+// @Success 200 {array} models.User "Successful operation"
+// @Failure 401 {object} Problem "Authentication required"
+// @Failure 403 {object} Problem "Admin role required"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/admin/users [get]
+func (c *RoleClient) GetUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := c.service.ListUsers(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to list users", slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(users); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
+	}
+}
+
+// SetUserRole assigns a role to a user.
+// @Summary Assign a role
+// @Description viewer reads the library, contributor also adds songs, editor also changes and deletes them, admin manages users and the service.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param id query int true "User ID"
+// @Param role body models.RoleRequest true "New role"
+// @Success 200 {object} models.User "Role assigned"
+// @Failure 400 {object} Problem "Invalid user ID or role"
+// @Failure 401 {object} Problem "Authentication required"
+// @Failure 403 {object} Problem "Admin role required"
+// @Failure 404 {object} Problem "User not found"
+// @Failure 409 {object} Problem "Admins cannot demote themselves"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/admin/users/role [put]
+func (c *RoleClient) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		writeError(w, r, apperrors.Validation("invalid_user_id", "id must be a positive integer"))
+		return
+	}
+
+	var req models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, apperrors.Validation("invalid_payload", "invalid request payload").Wrap(err))
+		return
+	}
+
+	user, err := c.service.Assign(r.Context(), id, req.Role)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to assign role", slog.Int("user_id", id), slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
@@ -3,10 +3,13 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
 
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
 	"github.com/KarmaBeLike/SongLibrary/internal/models"
 )
 
@@ -17,6 +20,9 @@ type (
 		DeleteSongByID(ctx context.Context, id int) error
 		UpdateSongByID(ctx context.Context, id int, updateRequest *models.UpdateSongRequest) error
 		AddSong(ctx context.Context, newSong models.NewSongRequest) (int, error)
+		AddSongAsync(ctx context.Context, newSong models.NewSongRequest) (int, int, error)
+		GetSongInfo(ctx context.Context, id int) (*models.SongInfo, error)
+		RefreshSong(ctx context.Context, id int, force bool) ([]string, error)
 	}
 	SongClient struct {
 		service songService
@@ -40,7 +46,7 @@ func NewSongClient(service songService) *SongClient {
 // @Param page query int false "Page number" example(1)
 // @Param limit query int false "Limit of songs per page" example(10)
 // @Success 200 {object} map[string]interface{} "Successful operation"
-// @Failure 500 {string} string "Internal server error"
+// @Failure 500 {object} Problem "Internal server error"
 // @Router /api/songs [get]
 func (c *SongClient) GetSongs(w http.ResponseWriter, r *http.Request) {
 	// Создаём экземпляр структуры фильтров
@@ -56,7 +62,7 @@ func (c *SongClient) GetSongs(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil || page < 1 {
 		page = 1
-		slog.Debug("Invalid page number, setting to default", slog.Int("page", page))
+		logging.FromContext(r.Context()).Debug("Invalid page number, setting to default", slog.Int("page", page))
 	}
 
 	filter.Page = page
@@ -65,21 +71,21 @@ func (c *SongClient) GetSongs(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil || limit < 1 {
 		limit = 10
-		slog.Debug("Invalid limit, setting to default", slog.Int("limit", limit))
+		logging.FromContext(r.Context()).Debug("Invalid limit, setting to default", slog.Int("limit", limit))
 	}
 
 	filter.Limit = limit
 
-	slog.Debug("Received filter request", slog.Any("filter", filter))
+	logging.FromContext(r.Context()).Debug("Received filter request", slog.Any("filter", filter))
 
 	songs, pagination, err := c.service.GetSongs(r.Context(), *filter)
 	if err != nil {
-		slog.Error("Failed to fetch songs", slog.Any("filter", filter), slog.Any("error", err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("Failed to fetch songs", slog.Any("filter", filter), slog.Any("error", err))
+		writeError(w, r, err)
 		return
 	}
 
-	slog.Info("Songs fetched successfully", slog.Int("song_count", len(songs)), slog.Any("pagination", pagination))
+	logging.FromContext(r.Context()).Info("Songs fetched successfully", slog.Int("song_count", len(songs)), slog.Any("pagination", pagination))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -98,29 +104,29 @@ func (c *SongClient) GetSongs(w http.ResponseWriter, r *http.Request) {
 // @Param page query int false "Page number" example(1)
 // @Param limit query int false "Limit of verses per page" example(1)
 // @Success 200 {object} models.SongVerses "Successful operation"
-// @Failure 400 {string} string "Invalid song ID or pagination parameters"
-// @Failure 404 {string} string "Song not found"
-// @Failure 500 {string} string "Internal server error"
+// @Failure 400 {object} Problem "Invalid song ID or pagination parameters"
+// @Failure 404 {object} Problem "Song not found"
+// @Failure 500 {object} Problem "Internal server error"
 // @Router /api/songs/lyrics [get]
 func (c *SongClient) GetSongLyrics(w http.ResponseWriter, r *http.Request) {
-	slog.Debug("Received request to get song by ID", slog.String("method", r.Method), slog.String("url", r.URL.String()))
+	logging.FromContext(r.Context()).Debug("Received request to get song by ID", slog.String("method", r.Method), slog.String("url", r.URL.String()))
 
 	idStr := r.URL.Query().Get("song_id")
 
 	if idStr == "" {
-		slog.Error("Invalid song ID", slog.Any("idStr", idStr))
-		http.Error(w, "Missing or invalid song_id", http.StatusBadRequest)
+		logging.FromContext(r.Context()).Error("Invalid song ID", slog.Any("idStr", idStr))
+		writeError(w, r, apperrors.Validation("invalid_song_id", "missing song_id"))
 		return
 	}
 
 	id, err := strconv.Atoi(idStr)
 
 	if err != nil || id <= 0 {
-		slog.Error("Invalid song ID", slog.String("idStr", idStr), slog.Any("error", err))
-		http.Error(w, "Invalid song ID.", http.StatusBadRequest)
+		logging.FromContext(r.Context()).Error("Invalid song ID", slog.String("idStr", idStr), slog.Any("error", err))
+		writeError(w, r, apperrors.Validation("invalid_song_id", "song_id must be a positive integer"))
 		return
 	}
-	slog.Info("Fetching song by ID", slog.Int("id", id))
+	logging.FromContext(r.Context()).Info("Fetching song by ID", slog.Int("id", id))
 
 	pageStr := r.URL.Query().Get("page")
 	limitStr := r.URL.Query().Get("limit")
@@ -132,70 +138,161 @@ func (c *SongClient) GetSongLyrics(w http.ResponseWriter, r *http.Request) {
 		page, err = strconv.Atoi(pageStr)
 
 		if err != nil || page <= 0 {
-			slog.Error("Invalid page number", slog.String("pageStr", pageStr), slog.Any("error", err))
-			http.Error(w, "Invalid page number. It must be a positive integer.", http.StatusBadRequest)
+			logging.FromContext(r.Context()).Error("Invalid page number", slog.String("pageStr", pageStr), slog.Any("error", err))
+			writeError(w, r, apperrors.Validation("invalid_page", "page must be a positive integer"))
 			return
 		}
-		slog.Debug("Page number set", slog.Int("page", page))
+		logging.FromContext(r.Context()).Debug("Page number set", slog.Int("page", page))
 	}
 
 	if limitStr != "" {
 		limit, err = strconv.Atoi(limitStr)
 
 		if err != nil || limit <= 0 {
-			slog.Error("Invalid limit value", slog.String("limitStr", limitStr), slog.Any("error", err))
-			http.Error(w, "Invalid limit value. It must be a positive integer.", http.StatusBadRequest)
+			logging.FromContext(r.Context()).Error("Invalid limit value", slog.String("limitStr", limitStr), slog.Any("error", err))
+			writeError(w, r, apperrors.Validation("invalid_limit", "limit must be a positive integer"))
 			return
 		}
-		slog.Debug("Limit set", slog.Int("limit", limit))
+		logging.FromContext(r.Context()).Debug("Limit set", slog.Int("limit", limit))
 	}
 
-	slog.Info("Fetching paginated song lyrics", slog.Int("id", id), slog.Int("page", page), slog.Int("limit", limit))
+	logging.FromContext(r.Context()).Info("Fetching paginated song lyrics", slog.Int("id", id), slog.Int("page", page), slog.Int("limit", limit))
 
 	response, err := c.service.GetPaginatedSongLyrics(r.Context(), id, page, limit)
 	if err != nil {
-		slog.Error("Failed to fetch song lyrics", slog.Int("id", id), slog.Any("error", err))
-		http.Error(w, err.Error(), http.StatusNotFound)
+		logging.FromContext(r.Context()).Error("Failed to fetch song lyrics", slog.Int("id", id), slog.Any("error", err))
+		writeError(w, r, err)
 		return
 	}
-	slog.Info("Song fetched successfully", slog.Int("id", id))
+	logging.FromContext(r.Context()).Info("Song fetched successfully", slog.Int("id", id))
 
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		slog.Error("Failed to encode response", slog.Any("error", err))
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
 		return
 	}
-	slog.Debug("Response sent", slog.Int("id", id), slog.Int("page", page), slog.Int("limit", limit))
+	logging.FromContext(r.Context()).Debug("Response sent", slog.Int("id", id), slog.Int("page", page), slog.Int("limit", limit))
+}
+
+// GetSongDetail returns a song together with the origin of its fields.
+// @Summary Get song with field provenance
+// @Description Returns the song and, for each recorded field, whether it came from a provider, a manual edit or an import, and when.
+// @Tags songs
+// @Produce json
+// @Param id query int true "Song ID" example(1)
+// @Success 200 {object} models.SongInfo "Successful operation"
+// @Failure 400 {object} Problem "Invalid song ID"
+// @Failure 404 {object} Problem "Song not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/songs/detail [get]
+func (c *SongClient) GetSongDetail(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		logging.FromContext(r.Context()).Warn("Invalid song ID received", slog.String("id", idStr))
+		writeError(w, r, apperrors.Validation("invalid_song_id", "id must be a positive integer"))
+		return
+	}
+
+	info, err := c.service.GetSongInfo(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to fetch song detail", slog.Int("id", id), slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// RefreshSong refetches the details of a song from the providers.
+// @Summary Refresh song details from the providers
+// @Description Replaces the stored details with the providers' current values. Manually edited fields are kept unless force=true.
+// @Tags songs
+// @Produce json
+// @Param id query int true "Song ID" example(1)
+// @Param force query bool false "Overwrite manually edited fields too"
+// @Success 200 {object} map[string]interface{} "Successful operation"
+// @Failure 400 {object} Problem "Invalid song ID"
+// @Failure 404 {object} Problem "Song or its details not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Failure 503 {object} Problem "Song details provider unavailable"
+// @Router /api/songs/refresh [post]
+func (c *SongClient) RefreshSong(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		logging.FromContext(r.Context()).Warn("Invalid song ID received", slog.String("id", idStr))
+		writeError(w, r, apperrors.Validation("invalid_song_id", "id must be a positive integer"))
+		return
+	}
+
+	force := false
+	if forceStr := r.URL.Query().Get("force"); forceStr != "" {
+		force, err = strconv.ParseBool(forceStr)
+		if err != nil {
+			writeError(w, r, apperrors.Validation("invalid_force", "force must be a boolean"))
+			return
+		}
+	}
+
+	fields, err := c.service.RefreshSong(r.Context(), id, force)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to refresh song", slog.Int("id", id), slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+	if fields == nil {
+		fields = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      id,
+		"updated": fields,
+	})
 }
 
 // AddSong adds a new song to the library.
 // @Summary Add a new song
 // @Description Adds a new song with the given details to the library.
+// @Description The source field controls the provider lookup: "manual" stores only the submitted text, releaseDate and link,
+// @Description "provider" takes all details from the providers, "merge" keeps the submitted fields and lets the providers fill the rest.
+// @Description With async=true the song is stored as pending right away and its details are fetched in the background.
 // @Tags songs
 // @Accept json
 // @Produce json
 // @Param newSong body models.NewSongRequest true "New song details"
+// @Param async query bool false "Fetch song details in the background"
 // @Success 201 {object} map[string]interface{} "Successful operation"
-// @Failure 400 {string} string "Invalid request payload"
-// @Failure 500 {string} string "Internal server error"
+// @Success 202 {object} map[string]interface{} "Song accepted, details are being fetched"
+// @Failure 400 {object} Problem "Invalid request payload or song details"
+// @Failure 404 {object} Problem "Song details not found upstream"
+// @Failure 409 {object} Problem "Song already exists"
+// @Failure 500 {object} Problem "Internal server error"
+// @Failure 503 {object} Problem "Song details provider unavailable"
 // @Router /api/songs [post]
 func (c *SongClient) AddSong(w http.ResponseWriter, r *http.Request) {
-	slog.Debug("Received request to add a new song", slog.String("method", r.Method), slog.String("url", r.URL.String()))
+	logging.FromContext(r.Context()).Debug("Received request to add a new song", slog.String("method", r.Method), slog.String("url", r.URL.String()))
 
 	var newSong models.NewSongRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&newSong); err != nil {
-		slog.Error("Invalid request payload", slog.Any("error", err))
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		logging.FromContext(r.Context()).Error("Invalid request payload", slog.Any("error", err))
+		writeError(w, r, apperrors.Validation("invalid_payload", "invalid request payload").Wrap(err))
+		return
+	}
+
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		c.addSongAsync(w, r, newSong)
 		return
 	}
 
 	id, err := c.service.AddSong(r.Context(), newSong)
 	if err != nil {
-		slog.Error("Failed to add song", slog.Any("error", err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("Failed to add song", slog.Any("error", err))
+		writeError(w, r, err)
 		return
 	}
 
@@ -208,6 +305,27 @@ func (c *SongClient) AddSong(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+func (c *SongClient) addSongAsync(w http.ResponseWriter, r *http.Request, newSong models.NewSongRequest) {
+	id, jobID, err := c.service.AddSongAsync(r.Context(), newSong)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to add song", slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Song accepted, details are being fetched",
+		"id":      id,
+		"job_id":  jobID,
+		"status":  models.SongStatusPending,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/api/jobs?id=%d", jobID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
 // UpdateSong updates the details of a song by its ID.
 // @Summary Update song by ID
 // @Description Update the details of a song using its ID.
@@ -217,39 +335,40 @@ func (c *SongClient) AddSong(w http.ResponseWriter, r *http.Request) {
 // @Param id query int true "Song ID" example(1)
 // @Param updateRequest body models.UpdateSongRequest true "Update song details"
 // @Success 200 {object} map[string]interface{} "Successful operation"
-// @Failure 400 {string} string "Invalid song ID or request body"
-// @Failure 404 {string} string "Song not found"
-// @Failure 500 {string} string "Internal server error"
+// @Failure 400 {object} Problem "Invalid song ID or request body"
+// @Failure 404 {object} Problem "Song not found"
+// @Failure 409 {object} Problem "Song already exists"
+// @Failure 500 {object} Problem "Internal server error"
 // @Router /api/songs [patch]
 func (c *SongClient) UpdateSong(w http.ResponseWriter, r *http.Request) {
-	slog.Debug("Received request to update song", slog.String("method", r.Method), slog.String("url", r.URL.String()))
+	logging.FromContext(r.Context()).Debug("Received request to update song", slog.String("method", r.Method), slog.String("url", r.URL.String()))
 
 	idStr := r.URL.Query().Get("id")
 	id, err := strconv.Atoi(idStr)
 
 	if err != nil || id <= 0 {
-		slog.Error("Invalid song ID", slog.String("idStr", idStr), slog.Any("error", err))
-		http.Error(w, "Invalid song ID. It must be a positive integer.", http.StatusBadRequest)
+		logging.FromContext(r.Context()).Error("Invalid song ID", slog.String("idStr", idStr), slog.Any("error", err))
+		writeError(w, r, apperrors.Validation("invalid_song_id", "id must be a positive integer"))
 		return
 	}
-	slog.Info("Updating song by ID", slog.Int("id", id))
+	logging.FromContext(r.Context()).Info("Updating song by ID", slog.Int("id", id))
 
 	var updateRequest models.UpdateSongRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&updateRequest); err != nil {
-		slog.Error("Failed to decode request body", slog.Any("error", err))
-		http.Error(w, "Invalid request body.", http.StatusBadRequest)
+		logging.FromContext(r.Context()).Error("Failed to decode request body", slog.Any("error", err))
+		writeError(w, r, apperrors.Validation("invalid_payload", "invalid request body").Wrap(err))
 		return
 	}
-	slog.Debug("Request body decoded", slog.Any("updateRequest", updateRequest))
+	logging.FromContext(r.Context()).Debug("Request body decoded", slog.Any("updateRequest", updateRequest))
 
 	if err := c.service.UpdateSongByID(r.Context(), id, &updateRequest); err != nil {
-		slog.Error("Failed to update song", slog.Int("id", id), slog.Any("error", err))
-		http.Error(w, err.Error(), http.StatusNotFound)
+		logging.FromContext(r.Context()).Error("Failed to update song", slog.Int("id", id), slog.Any("error", err))
+		writeError(w, r, err)
 		return
 	}
 
-	slog.Info("Song updated successfully", slog.Int("id", id))
+	logging.FromContext(r.Context()).Info("Song updated successfully", slog.Int("id", id))
 
 	response := map[string]interface{}{
 		"message": "Song updated successfully.",
@@ -259,12 +378,11 @@ func (c *SongClient) UpdateSong(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		slog.Error("Failed to encode response", slog.Any("error", err))
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
 		return
 	}
 
-	slog.Debug("Response sent", slog.Int("id", id))
+	logging.FromContext(r.Context()).Debug("Response sent", slog.Int("id", id))
 }
 
 // DeleteSong deletes a song by its ID
@@ -275,36 +393,37 @@ func (c *SongClient) UpdateSong(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id query int true "Song ID"
 // @Success 200 {object} map[string]interface{} "Song deleted successfully"
-// @Failure 400 {string} string "Invalid song ID. It must be a positive integer."
-// @Failure 404 {string} string "Song not found"
+// @Failure 400 {object} Problem "Invalid song ID. It must be a positive integer."
+// @Failure 404 {object} Problem "Song not found"
+// @Failure 500 {object} Problem "Internal server error"
 // @Router /api/songs [delete]
 func (c *SongClient) DeleteSong(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("id")
 	id, err := strconv.Atoi(idStr)
 
 	if err != nil || id <= 0 {
-		slog.Warn("Invalid song ID received", slog.String("id", idStr))
-		http.Error(w, "Invalid song ID. It must be a positive integer.", http.StatusBadRequest)
+		logging.FromContext(r.Context()).Warn("Invalid song ID received", slog.String("id", idStr))
+		writeError(w, r, apperrors.Validation("invalid_song_id", "id must be a positive integer"))
 		return
 	}
 
-	slog.Info("Starting to delete song", slog.Int("song_id", id))
+	logging.FromContext(r.Context()).Info("Starting to delete song", slog.Int("song_id", id))
 
 	err = c.service.DeleteSongByID(r.Context(), id)
 	if err != nil {
-		slog.Error("Failed to delete song", slog.Int("song_id", id), slog.Any("error", err))
-		http.Error(w, err.Error(), http.StatusNotFound)
+		logging.FromContext(r.Context()).Error("Failed to delete song", slog.Int("song_id", id), slog.Any("error", err))
+		writeError(w, r, err)
 		return
 	}
 
-	slog.Info("Song deleted successfully", slog.Int("song_id", id))
+	logging.FromContext(r.Context()).Info("Song deleted successfully", slog.Int("song_id", id))
 
 	response := map[string]interface{}{
 		"message": "Song deleted successfully.",
 		"id":      id,
 	}
 
-	slog.Debug("Sending delete song response", slog.Any("response", response))
+	logging.FromContext(r.Context()).Debug("Sending delete song response", slog.Any("response", response))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
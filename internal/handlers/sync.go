@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	syncScheduler interface {
+		ListRuns(ctx context.Context, limit int) ([]models.SyncRun, error)
+		Trigger() bool
+	}
+	SyncClient struct {
+		scheduler syncScheduler
+	}
+)
+
+func NewSyncClient(scheduler syncScheduler) *SyncClient {
+	return &SyncClient{
+		scheduler: scheduler,
+	}
+}
+
+// GetSyncRuns lists the latest runs of the song resync job.
+// @Summary List song resync runs
+// @Description Returns the latest runs of the job that fills in missing song details, newest first.
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Number of runs to return" example(20)
+// @Success 200 {array} models.SyncRun "Successful operation"
+// @Failure 400 {object} Problem "Invalid limit"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/admin/sync-runs [get]
+func (c *SyncClient) GetSyncRuns(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > 1000 {
+			writeError(w, r, apperrors.Validation("invalid_limit", "limit must be between 1 and 1000"))
+			return
+		}
+	}
+
+	runs, err := c.scheduler.ListRuns(r.Context(), limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to list sync runs", slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(runs); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
+	}
+}
+
+// StartSyncRun starts a song resync run without waiting for the schedule.
+// @Summary Start a song resync run
+// @Description Queues a run of the job that fills in missing song details.
+// @Tags admin
+// @Produce json
+// @Success 202 {object} map[string]interface{} "Run queued"
+// @Failure 409 {object} Problem "A run is already queued"
+// @Router /api/admin/sync-runs [post]
+func (c *SyncClient) StartSyncRun(w http.ResponseWriter, r *http.Request) {
+	if !c.scheduler.Trigger() {
+		writeError(w, r, apperrors.Conflict("sync_already_queued", "a sync run is already queued"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Sync run queued",
+	})
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/auth"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	sessionService interface {
+		Register(ctx context.Context, creds models.Credentials) (*models.User, error)
+		Login(ctx context.Context, creds models.Credentials) (*models.TokenPair, error)
+		Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error)
+		Logout(ctx context.Context, refreshToken string) error
+	}
+	UserClient struct {
+		service sessionService
+	}
+)
+
+func NewUserClient(service sessionService) *UserClient {
+	return &UserClient{
+		service: service,
+	}
+}
+
+// Register creates a user account.
+// @Summary Register a user
+// @Description Emails are case-insensitive, passwords must be 8 to 72 bytes long.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body models.Credentials true "Email and password"
+// @Success 201 {object} models.User "User registered"
+// @Failure 400 {object} Problem "Invalid email or password"
+// @Failure 403 {object} Problem "Registration is disabled"
+// @Failure 409 {object} Problem "Email already registered"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/auth/register [post]
+func (c *UserClient) Register(w http.ResponseWriter, r *http.Request) {
+	var creds models.Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		writeError(w, r, apperrors.Validation("invalid_payload", "invalid request payload").Wrap(err))
+		return
+	}
+
+	user, err := c.service.Register(r.Context(), creds)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to register user", slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// Login starts a session.
+// @Summary Log in
+// @Description Returns an access token to send as "Authorization: Bearer <token>" and a refresh token for /api/auth/refresh.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body models.Credentials true "Email and password"
+// @Success 200 {object} models.TokenPair "Logged in"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 401 {object} Problem "Invalid email or password"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/auth/login [post]
+func (c *UserClient) Login(w http.ResponseWriter, r *http.Request) {
+	var creds models.Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		writeError(w, r, apperrors.Validation("invalid_payload", "invalid request payload").Wrap(err))
+		return
+	}
+
+	tokens, err := c.service.Login(r.Context(), creds)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeTokens(w, r, tokens)
+}
+
+// Refresh exchanges a refresh token for a new token pair.
+// @Summary Refresh tokens
+// @Description Every refresh token can be used once. Using one again ends its session.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body models.RefreshRequest true "Refresh token"
+// @Success 200 {object} models.TokenPair "New tokens"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 401 {object} Problem "Invalid, expired or reused refresh token"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/auth/refresh [post]
+func (c *UserClient) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, apperrors.Validation("invalid_payload", "invalid request payload").Wrap(err))
+		return
+	}
+
+	tokens, err := c.service.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeTokens(w, r, tokens)
+}
+
+// Logout ends the session of a refresh token.
+// @Summary Log out
+// @Description Revokes the session, its access and refresh tokens stop working.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body models.RefreshRequest true "Refresh token"
+// @Success 200 {object} map[string]interface{} "Logged out"
+// @Failure 400 {object} Problem "Invalid request payload"
+// @Failure 401 {object} Problem "Invalid refresh token"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/auth/logout [post]
+func (c *UserClient) Logout(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, apperrors.Validation("invalid_payload", "invalid request payload").Wrap(err))
+		return
+	}
+
+	if err := c.service.Logout(r.Context(), req.RefreshToken); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Logged out",
+	})
+}
+
+// Me describes the caller.
+// @Summary Current caller
+// @Description Returns the user or API key the request was authenticated as.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.Identity "Authenticated caller"
+// @Failure 401 {object} Problem "Authentication required"
+// @Router /api/auth/me [get]
+func (c *UserClient) Me(w http.ResponseWriter, r *http.Request) {
+	identity := auth.IdentityFromContext(r.Context())
+	if identity == nil {
+		writeError(w, r, apperrors.Unauthorized("authentication_required", "an api key or access token is required"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(identity); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
+	}
+}
+
+func writeTokens(w http.ResponseWriter, r *http.Request, tokens *models.TokenPair) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(tokens); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	webhookService interface {
+		CreateSubscription(ctx context.Context, req models.NewWebhookRequest) (*models.WebhookSubscription, error)
+		ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+		DeleteSubscription(ctx context.Context, id int) error
+		ListDeliveries(ctx context.Context, subscriptionID, limit int) ([]models.WebhookDelivery, error)
+		Redeliver(ctx context.Context, id int) (*models.WebhookDelivery, error)
+	}
+	WebhookClient struct {
+		service webhookService
+	}
+)
+
+func NewWebhookClient(service webhookService) *WebhookClient {
+	return &WebhookClient{
+		service: service,
+	}
+}
+
+// CreateWebhook subscribes a URL to song events.
+// @Summary Create a webhook subscription
+// @Description Subscribes a URL to song.created, song.updated and song.deleted events, or to the listed ones only.
+// @Description Deliveries are signed: X-Webhook-Signature is "sha256=" + hex HMAC-SHA256 of X-Webhook-Timestamp + "." + body with the secret.
+// @Description The secret is only returned in this response.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param subscription body models.NewWebhookRequest true "Subscription"
+// @Success 201 {object} models.WebhookSubscription "Subscription created"
+// @Failure 400 {object} Problem "Invalid URL or event type"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/admin/webhooks [post]
+func (c *WebhookClient) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req models.NewWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, apperrors.Validation("invalid_payload", "invalid request payload").Wrap(err))
+		return
+	}
+
+	sub, err := c.service.CreateSubscription(r.Context(), req)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to create webhook subscription", slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/api/admin/webhooks/deliveries?subscription_id=%d", sub.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// GetWebhooks lists the webhook subscriptions.
+// @Summary List webhook subscriptions
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} models.WebhookSubscription "Successful operation"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/admin/webhooks [get]
+func (c *WebhookClient) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs, err := c.service.ListSubscriptions(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to list webhook subscriptions", slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(subs); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
+	}
+}
+
+// DeleteWebhook removes a webhook subscription and its deliveries.
+// @Summary Delete a webhook subscription
+// @Tags webhooks
+// @Produce json
+// @Param id query int true "Subscription ID"
+// @Success 200 {object} map[string]interface{} "Subscription deleted"
+// @Failure 400 {object} Problem "Invalid subscription ID"
+// @Failure 404 {object} Problem "Subscription not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/admin/webhooks [delete]
+func (c *WebhookClient) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		writeError(w, r, apperrors.Validation("invalid_subscription_id", "id must be a positive integer"))
+		return
+	}
+
+	if err := c.service.DeleteSubscription(r.Context(), id); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to delete webhook subscription", slog.Int("subscription_id", id), slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Webhook subscription deleted",
+		"id":      id,
+	})
+}
+
+// GetDeliveries lists the latest webhook deliveries.
+// @Summary List webhook deliveries
+// @Description Returns the latest deliveries with their status, attempts, response status and last error, newest first.
+// @Tags webhooks
+// @Produce json
+// @Param subscription_id query int false "Only deliveries of this subscription"
+// @Param limit query int false "Number of deliveries to return" example(50)
+// @Success 200 {array} models.WebhookDelivery "Successful operation"
+// @Failure 400 {object} Problem "Invalid parameters"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/admin/webhooks/deliveries [get]
+func (c *WebhookClient) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	subscriptionID := 0
+	if idStr := r.URL.Query().Get("subscription_id"); idStr != "" {
+		var err error
+		subscriptionID, err = strconv.Atoi(idStr)
+		if err != nil || subscriptionID <= 0 {
+			writeError(w, r, apperrors.Validation("invalid_subscription_id", "subscription_id must be a positive integer"))
+			return
+		}
+	}
+
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > 1000 {
+			writeError(w, r, apperrors.Validation("invalid_limit", "limit must be between 1 and 1000"))
+			return
+		}
+	}
+
+	deliveries, err := c.service.ListDeliveries(r.Context(), subscriptionID, limit)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to list webhook deliveries", slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to encode response", slog.Any("error", err))
+	}
+}
+
+// Redeliver sends the event of a past delivery again.
+// @Summary Redeliver a webhook
+// @Description Queues a new delivery of the same event to the same subscription.
+// @Tags webhooks
+// @Produce json
+// @Param id query int true "Delivery ID"
+// @Success 202 {object} models.WebhookDelivery "Delivery queued"
+// @Failure 400 {object} Problem "Invalid delivery ID"
+// @Failure 404 {object} Problem "Delivery not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/admin/webhooks/deliveries/redeliver [post]
+func (c *WebhookClient) Redeliver(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		writeError(w, r, apperrors.Validation("invalid_delivery_id", "id must be a positive integer"))
+		return
+	}
+
+	delivery, err := c.service.Redeliver(r.Context(), id)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to redeliver webhook", slog.Int("delivery_id", id), slog.Any("error", err))
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
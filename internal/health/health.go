@@ -0,0 +1,94 @@
+// Package health tells whether the service can serve requests.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+const defaultTimeout = 2 * time.Second
+
+type (
+	// Check is one dependency the service needs. Func gets a context that is
+	// cancelled after Timeout.
+	Check struct {
+		Name    string
+		Timeout time.Duration
+		Func    func(ctx context.Context) error
+	}
+
+	// Checker runs the readiness checks. Once Drain is called it reports
+	// shutting down, so the load balancer stops sending requests before the
+	// server stops taking them.
+	Checker struct {
+		checks   []Check
+		draining atomic.Bool
+	}
+)
+
+func NewChecker(checks ...Check) *Checker {
+	for i := range checks {
+		if checks[i].Timeout <= 0 {
+			checks[i].Timeout = defaultTimeout
+		}
+	}
+	return &Checker{checks: checks}
+}
+
+// Ready runs all checks at once and reports each of them. The service is
+// ready when every check passed.
+func (c *Checker) Ready(ctx context.Context) models.Readiness {
+	if c.draining.Load() {
+		return models.Readiness{Status: models.HealthShuttingDown, Checks: []models.CheckResult{}}
+	}
+
+	results := make([]models.CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	readiness := models.Readiness{Status: models.HealthReady, Checks: results}
+	for _, result := range results {
+		if result.Status != models.CheckPassed {
+			readiness.Status = models.HealthNotReady
+		}
+	}
+	return readiness
+}
+
+// Drain makes the service report not ready from now on.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+func run(ctx context.Context, check Check) models.CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Func(ctx)
+	result := models.CheckResult{
+		Name:     check.Name,
+		Status:   models.CheckPassed,
+		Duration: time.Since(start).Round(time.Microsecond).String(),
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s: %w", check.Timeout, err)
+		}
+		result.Status = models.CheckFailed
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+// Package metrics holds the Prometheus collectors of the service and serves
+// them on /metrics.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "songlibrary"
+
+// Outcomes of song detail lookups.
+const (
+	OutcomeSuccess     = "success"
+	OutcomeNotFound    = "not_found"
+	OutcomeRejected    = "rejected"
+	OutcomeUnavailable = "unavailable"
+)
+
+var (
+	// Registry holds only our collectors and the Go and process ones, not
+	// whatever libraries register globally.
+	Registry = prometheus.NewRegistry()
+
+	factory = promauto.With(Registry)
+
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time spent serving HTTP requests by route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	dbDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time spent executing SQL statements by operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation"})
+
+	dbErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "SQL statements that failed by operation.",
+	}, []string{"operation"})
+
+	upstreamDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Duration of single requests to song detail providers, retries are observed separately.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+
+	upstreamLookups = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_lookups_total",
+		Help:      "Song detail lookups by provider and outcome, after retries.",
+	}, []string{"provider", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB exports the connection pool stats of db.
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+func ObserveHTTP(method, route string, status int, d time.Duration) {
+	httpDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+func ObserveQuery(operation string, d time.Duration, err error) {
+	dbDuration.WithLabelValues(operation).Observe(d.Seconds())
+	if err != nil {
+		dbErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+func ObserveUpstreamRequest(provider string, d time.Duration) {
+	upstreamDuration.WithLabelValues(provider).Observe(d.Seconds())
+}
+
+func CountUpstreamLookup(provider, outcome string) {
+	upstreamLookups.WithLabelValues(provider, outcome).Inc()
+}
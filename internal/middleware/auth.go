@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/auth"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+type (
+	Authenticator interface {
+		Authenticate(ctx context.Context, credential string) (*models.Identity, error)
+	}
+
+	// ErrorWriter answers a request with an error response.
+	ErrorWriter func(w http.ResponseWriter, r *http.Request, err error)
+)
+
+// Authenticate identifies the caller by the API key in the X-API-Key header,
+// or the API key or user access token in an "Authorization: Bearer" header,
+// and stores the identity in the request context. Requests without
+// credentials pass on anonymously, invalid ones are rejected.
+func Authenticate(authenticator Authenticator, writeError ErrorWriter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			credential := credentials(r)
+			if credential == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			identity, err := authenticator.Authenticate(r.Context(), credential)
+			if err != nil {
+				logging.FromContext(r.Context()).Warn("Authentication failed", slog.Any("error", err))
+				w.Header().Set("WWW-Authenticate", `Bearer realm="SongLibrary"`)
+				writeError(w, r, err)
+				return
+			}
+
+			logging.FromContext(r.Context()).Debug("Request authenticated",
+				slog.String("kind", identity.Kind), slog.Int("id", identity.ID), slog.String("name", identity.Name))
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// RequirePermission rejects anonymous callers and callers whose role does not
+// grant the permission. An unknown permission is granted to nobody, so it
+// panics on it instead of shutting a route for good over a typo.
+func RequirePermission(permission string, writeError ErrorWriter) func(http.Handler) http.Handler {
+	if !auth.KnownPermission(permission) {
+		panic(fmt.Sprintf("middleware: unknown permission %q", permission))
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := auth.IdentityFromContext(r.Context())
+			if identity == nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="SongLibrary"`)
+				writeError(w, r, apperrors.Unauthorized("authentication_required", "an api key or access token is required"))
+				return
+			}
+			if !auth.Can(identity, permission) {
+				logging.FromContext(r.Context()).Warn("Access denied",
+					slog.String("kind", identity.Kind), slog.Int("id", identity.ID), slog.String("role", identity.Role),
+					slog.String("permission", permission), slog.String("method", r.Method), slog.String("path", r.URL.Path))
+				writeError(w, r, apperrors.Forbidden("permission_denied", "this action needs the %q permission, which role %q lacks", permission, identity.Role))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func credentials(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/metrics"
+)
+
+// Metrics records the duration of every request by route template and
+// status.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		metrics.ObserveHTTP(r.Method, routeTemplate(r), rec.statusCode(), time.Since(start))
+	})
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/auth"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/ratelimit"
+)
+
+type RateLimiter interface {
+	Allow(ctx context.Context, budget, client string) (ratelimit.Result, error)
+	Refund(ctx context.Context, budget, client string) error
+}
+
+// RateLimit takes a token from each of the budgets of the caller: its API key
+// or user when authenticated, its IP otherwise. When one is exhausted the
+// request is rejected with 429 and the tokens taken from the others are put
+// back. The most constrained budget is reported in the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers.
+//
+// Handlers may charge further budgets with ratelimit.Spend once they know a
+// request needs them; a refusal then puts back the route's tokens as well.
+//
+// With proxyHops above zero the client IP is taken from X-Forwarded-For, that
+// many entries from the right: 1 for a single proxy appending the address it
+// saw. Entries further left are sent by the client and can't be trusted.
+func RateLimit(limiter RateLimiter, proxyHops int, writeError ErrorWriter, budgets ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			charge := &charge{limiter: limiter, client: clientKey(r, proxyHops)}
+
+			var tightest *ratelimit.Result
+			for _, budget := range budgets {
+				result, err := charge.take(r.Context(), budget)
+				if err != nil {
+					charge.reject(w, r, budget, result)
+					writeError(w, r, err)
+					return
+				}
+				if result != nil && (tightest == nil || result.Remaining < tightest.Remaining) {
+					tightest = result
+				}
+			}
+
+			if tightest != nil {
+				setRateLimitHeaders(w, *tightest)
+			}
+			spend := func(ctx context.Context, budget string) error {
+				result, err := charge.take(ctx, budget)
+				if err != nil {
+					charge.reject(w, r, budget, result)
+				}
+				return err
+			}
+			next.ServeHTTP(w, r.WithContext(ratelimit.WithSpender(r.Context(), spend)))
+		})
+	}
+}
+
+// charge tracks the tokens taken for a request, so they can be put back when
+// it is refused.
+type charge struct {
+	limiter RateLimiter
+	client  string
+	taken   []string
+}
+
+// take takes a token from the budget. The result is nil when the budget is
+// unlimited or the limiter failed, better to serve the request then than to
+// fail because the limiter is down.
+func (c *charge) take(ctx context.Context, budget string) (*ratelimit.Result, error) {
+	result, err := c.limiter.Allow(ctx, budget, c.client)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Rate limiter failed, allowing request",
+			slog.String("budget", budget), slog.Any("error", err))
+		return nil, nil
+	}
+	if result.Limit == 0 {
+		return nil, nil
+	}
+	if !result.Allowed {
+		return &result, apperrors.RateLimited("rate_limited", "too many %s requests, retry in %d seconds", budget, seconds(result.RetryAfter))
+	}
+	c.taken = append(c.taken, budget)
+	return &result, nil
+}
+
+// reject puts back the tokens taken so far and sets the headers of the
+// exhausted budget.
+func (c *charge) reject(w http.ResponseWriter, r *http.Request, budget string, result *ratelimit.Result) {
+	logging.FromContext(r.Context()).Warn("Rate limit exceeded",
+		slog.String("budget", budget), slog.String("client", c.client),
+		slog.String("method", r.Method), slog.String("path", r.URL.Path))
+
+	for _, taken := range c.taken {
+		if err := c.limiter.Refund(r.Context(), taken, c.client); err != nil {
+			logging.FromContext(r.Context()).Warn("Failed to refund rate limit token",
+				slog.String("budget", taken), slog.Any("error", err))
+		}
+	}
+	c.taken = nil
+
+	setRateLimitHeaders(w, *result)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, result ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+}
+
+// seconds rounds up, so clients waiting that long find a token.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func clientKey(r *http.Request, proxyHops int) string {
+	if identity := auth.IdentityFromContext(r.Context()); identity != nil {
+		return identity.Kind + ":" + strconv.Itoa(identity.ID)
+	}
+
+	if proxyHops > 0 {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			ips := strings.Split(strings.Join(forwarded, ","), ",")
+			if len(ips) >= proxyHops {
+				return "ip:" + strings.TrimSpace(ips[len(ips)-proxyHops])
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,181 @@
+package mockapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Fixture is a song the mock server knows about. Status, if set, makes
+	// the server answer with that status code instead of the details.
+	Fixture struct {
+		Group       string `json:"group"`
+		Song        string `json:"song"`
+		ReleaseDate string `json:"releaseDate"`
+		Text        string `json:"text"`
+		Link        string `json:"link"`
+		Status      int    `json:"status,omitempty"`
+	}
+
+	Options struct {
+		// Latency is added to every response, Jitter adds up to that much more.
+		Latency time.Duration
+		Jitter  time.Duration
+		// ErrorRate is the share of requests, from 0 to 1, answered with ErrorStatus.
+		ErrorRate   float64
+		ErrorStatus int
+		// RetryAfter is sent with injected 429 and 503 responses.
+		RetryAfter time.Duration
+		Seed       uint64
+	}
+
+	// Server serves the upstream /info?group=&song= contract from fixtures.
+	Server struct {
+		fixtures map[string]Fixture
+		opts     Options
+
+		mu  sync.Mutex
+		rnd *rand.Rand
+	}
+)
+
+func NewServer(fixtures []Fixture, opts Options) *Server {
+	if opts.ErrorStatus == 0 {
+		opts.ErrorStatus = http.StatusInternalServerError
+	}
+
+	seed := opts.Seed
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano())
+	}
+
+	s := &Server{
+		fixtures: make(map[string]Fixture, len(fixtures)),
+		opts:     opts,
+		rnd:      rand.New(rand.NewPCG(seed, seed)),
+	}
+	for _, f := range fixtures {
+		s.fixtures[key(f.Group, f.Song)] = f
+	}
+	return s
+}
+
+// LoadFixtures reads every *.json file in dir. A file holds either one
+// fixture or an array of them.
+func LoadFixtures(dir string) ([]Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures []Fixture
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read fixture %s: %w", path, err)
+		}
+
+		var many []Fixture
+		if err := json.Unmarshal(content, &many); err == nil {
+			fixtures = append(fixtures, many...)
+			continue
+		}
+
+		var one Fixture
+		if err := json.Unmarshal(content, &one); err != nil {
+			return nil, fmt.Errorf("parse fixture %s: %w", path, err)
+		}
+		fixtures = append(fixtures, one)
+	}
+
+	return fixtures, nil
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info", s.info)
+	return mux
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	group := r.URL.Query().Get("group")
+	song := r.URL.Query().Get("song")
+
+	if delay := s.delay(); delay > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+
+	if group == "" || song == "" {
+		http.Error(w, "group and song are required", http.StatusBadRequest)
+		return
+	}
+
+	if s.injectError() {
+		slog.Info("Injecting error", slog.String("group", group), slog.String("song", song), slog.Int("status", s.opts.ErrorStatus))
+		s.writeStatus(w, s.opts.ErrorStatus)
+		return
+	}
+
+	fixture, ok := s.fixtures[key(group, song)]
+	if !ok {
+		slog.Info("Song not found", slog.String("group", group), slog.String("song", song))
+		http.Error(w, "song not found", http.StatusNotFound)
+		return
+	}
+
+	if fixture.Status != 0 && fixture.Status != http.StatusOK {
+		s.writeStatus(w, fixture.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"releaseDate": fixture.ReleaseDate,
+		"text":        fixture.Text,
+		"link":        fixture.Link,
+	})
+}
+
+func (s *Server) writeStatus(w http.ResponseWriter, status int) {
+	if (status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable) && s.opts.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.opts.RetryAfter.Seconds())))
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (s *Server) delay() time.Duration {
+	d := s.opts.Latency
+	if s.opts.Jitter > 0 {
+		s.mu.Lock()
+		d += time.Duration(s.rnd.Int64N(int64(s.opts.Jitter)))
+		s.mu.Unlock()
+	}
+	return d
+}
+
+func (s *Server) injectError() bool {
+	if s.opts.ErrorRate <= 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rnd.Float64() < s.opts.ErrorRate
+}
+
+func key(group, song string) string {
+	return strings.ToLower(strings.TrimSpace(group)) + "\x00" + strings.ToLower(strings.TrimSpace(song))
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type (
+	BreakerStatus struct {
+		Name        string     `json:"name"`
+		State       string     `json:"state"`
+		Requests    int        `json:"requests"`
+		Failures    int        `json:"failures"`
+		FailureRate float64    `json:"failure_rate"`
+		OpenedAt    *time.Time `json:"opened_at,omitempty"`
+		RetryAt     *time.Time `json:"retry_at,omitempty"`
+	}
+
+	CacheStats struct {
+		Name         string `json:"name"`
+		Entries      int    `json:"entries"`
+		Capacity     int    `json:"capacity"`
+		Hits         int64  `json:"hits"`
+		NegativeHits int64  `json:"negative_hits"`
+		Misses       int64  `json:"misses"`
+		Shared       int64  `json:"shared"`
+		Evictions    int64  `json:"evictions"`
+	}
+)
@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// API key scopes. Each scope includes the ones before it: write allows
+// reading, admin allows everything.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// Roles of users, each role may do everything the ones before it may. API
+// keys act as viewers with the read scope, editors with write and admins
+// with admin.
+const (
+	RoleViewer      = "viewer"
+	RoleContributor = "contributor"
+	RoleEditor      = "editor"
+	RoleAdmin       = "admin"
+)
+
+var Roles = []string{RoleViewer, RoleContributor, RoleEditor, RoleAdmin}
+
+// Permissions guard the operations of the API.
+const (
+	PermReadSongs   = "songs:read"
+	PermCreateSongs = "songs:create"
+	PermUpdateSongs = "songs:update"
+	PermDeleteSongs = "songs:delete"
+	PermManageUsers = "users:manage"
+	// PermManageSystem covers maintenance: breakers, caches, sync runs,
+	// webhooks and API keys.
+	PermManageSystem = "system:manage"
+)
+
+// Kinds of authenticated callers.
+const (
+	IdentityAPIKey = "api_key"
+	IdentityUser   = "user"
+)
+
+type (
+	// Identity is the authenticated caller of a request.
+	Identity struct {
+		Kind   string   `json:"kind"`
+		ID     int      `json:"id"`
+		Name   string   `json:"name"`
+		Role   string   `json:"role"`
+		Scopes []string `json:"scopes,omitempty"`
+		// SessionID is the login session a user's token belongs to.
+		SessionID string `json:"-"`
+	}
+
+	APIKey struct {
+		ID         int        `json:"key_id"`
+		Name       string     `json:"name"`
+		Prefix     string     `json:"prefix"`
+		Scopes     []string   `json:"scopes"`
+		CreatedAt  time.Time  `json:"created_at"`
+		LastUsedAt *time.Time `json:"last_used_at"`
+		RevokedAt  *time.Time `json:"revoked_at"`
+	}
+
+	NewAPIKeyRequest struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes" enums:"read,write,admin"`
+	}
+
+	RoleRequest struct {
+		Role string `json:"role" enums:"viewer,contributor,editor,admin"`
+	}
+
+	// CreatedAPIKey carries the key itself, which is shown only once.
+	CreatedAPIKey struct {
+		APIKey
+		Key string `json:"key"`
+	}
+)
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Change event types.
+const (
+	EventSongCreated  = "song.created"
+	EventSongUpdated  = "song.updated"
+	EventSongDeleted  = "song.deleted"
+	EventGroupCreated = "group.created"
+)
+
+// EventTypes lists every event type subscribers can ask for.
+var EventTypes = []string{EventSongCreated, EventSongUpdated, EventSongDeleted, EventGroupCreated}
+
+type (
+	// Event describes a change to a song or a group. Fields lists the changed
+	// fields of an update.
+	Event struct {
+		ID         string    `json:"id"`
+		Type       string    `json:"type"`
+		OccurredAt time.Time `json:"occurred_at"`
+		SongID     int       `json:"song_id,omitempty"`
+		GroupID    int       `json:"group_id,omitempty"`
+		Group      string    `json:"group,omitempty"`
+		Fields     []string  `json:"fields,omitempty"`
+	}
+
+	// OutboxEntry is an event stored with the change that caused it, waiting
+	// to be published.
+	OutboxEntry struct {
+		ID    int64
+		Event Event
+	}
+)
@@ -0,0 +1,26 @@
+package models
+
+// Readiness statuses. A service shutting down is not ready whatever its
+// checks say.
+const (
+	HealthReady        = "ready"
+	HealthNotReady     = "not_ready"
+	HealthShuttingDown = "shutting_down"
+
+	CheckPassed = "pass"
+	CheckFailed = "fail"
+)
+
+type (
+	Readiness struct {
+		Status string        `json:"status"`
+		Checks []CheckResult `json:"checks"`
+	}
+
+	CheckResult struct {
+		Name     string `json:"name"`
+		Status   string `json:"status"`
+		Duration string `json:"duration"`
+		Error    string `json:"error,omitempty"`
+	}
+)
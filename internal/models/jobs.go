@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Song statuses. A song added asynchronously stays pending until its
+// details are fetched.
+const (
+	SongStatusPending = "pending"
+	SongStatusReady   = "ready"
+	SongStatusFailed  = "failed"
+)
+
+// Enrichment job statuses.
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+type (
+	EnrichmentJob struct {
+		ID            int       `json:"job_id"`
+		SongID        int       `json:"song_id"`
+		Status        string    `json:"status"`
+		Attempts      int       `json:"attempts"`
+		MaxAttempts   int       `json:"max_attempts"`
+		LastError     *string   `json:"last_error"`
+		NextAttemptAt time.Time `json:"next_attempt_at"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+	}
+)
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Where a field value came from.
+const (
+	OriginProvider = "provider"
+	OriginManual   = "manual"
+	OriginImport   = "import"
+)
+
+// Names of the song name fields, the detail fields are listed in songs.go.
+// FieldStatus only appears in change events.
+const (
+	FieldGroup  = "group"
+	FieldSong   = "song"
+	FieldStatus = "status"
+)
+
+type (
+	// FieldOrigin records who supplied a field value. Provider is set for
+	// OriginProvider only.
+	FieldOrigin struct {
+		Origin   string `json:"origin"`
+		Provider string `json:"provider,omitempty"`
+	}
+
+	FieldProvenance struct {
+		Field     string    `json:"field"`
+		Origin    string    `json:"origin"`
+		Provider  *string   `json:"provider,omitempty"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	SongInfo struct {
+		Song
+		Provenance []FieldProvenance `json:"provenance"`
+	}
+
+	// ApplyOptions control how fetched details are written to a stored song.
+	ApplyOptions struct {
+		// OnlyEmpty restricts the update to fields that have no value yet.
+		OnlyEmpty bool
+		// Force overwrites manually set fields too.
+		Force bool
+		// MarkReady moves a pending song to the ready state.
+		MarkReady bool
+	}
+)
@@ -1,5 +1,20 @@
 package models
 
+// Where the details of a new song come from: only the request, only the
+// providers, or the request with the gaps filled in by the providers.
+const (
+	SourceManual   = "manual"
+	SourceProvider = "provider"
+	SourceMerge    = "merge"
+)
+
+// Names of the song detail fields, used to record where each value came from.
+const (
+	FieldText        = "text"
+	FieldReleaseDate = "releaseDate"
+	FieldLink        = "link"
+)
+
 type (
 	Song struct {
 		ID          int     `json:"song_id"`
@@ -8,6 +23,7 @@ type (
 		Text        *string `json:"text"`
 		ReleaseDate *string `json:"releaseDate"`
 		Link        *string `json:"link"`
+		Status      string  `json:"status"`
 	}
 	Group struct {
 		ID   int    `json:"group_id"`
@@ -47,13 +63,21 @@ type (
 	}
 
 	NewSongRequest struct {
-		Group string `json:"group"`
-		Song  string `json:"song"`
+		Group       string  `json:"group"`
+		Song        string  `json:"song"`
+		Text        *string `json:"text,omitempty"`
+		ReleaseDate *string `json:"releaseDate,omitempty"`
+		Link        *string `json:"link,omitempty"`
+		// Source is one of SourceManual, SourceProvider or SourceMerge. By default
+		// it is SourceProvider if no details are given and SourceMerge otherwise.
+		Source string `json:"source,omitempty" enums:"manual,provider,merge"`
 	}
 
 	SongDetail struct {
 		ReleaseDate string `json:"releaseDate"`
 		Text        string `json:"text"`
 		Link        string `json:"link"`
+		// Sources maps a field name to where its value came from.
+		Sources map[string]FieldOrigin `json:"-"`
 	}
 )
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Sync run statuses. A partial run updated some songs but failed on others.
+const (
+	SyncStatusRunning   = "running"
+	SyncStatusSucceeded = "succeeded"
+	SyncStatusPartial   = "partial"
+	SyncStatusFailed    = "failed"
+	SyncStatusCancelled = "cancelled"
+)
+
+type (
+	SyncRun struct {
+		ID         int        `json:"run_id"`
+		Status     string     `json:"status"`
+		Checked    int        `json:"songs_checked"`
+		Updated    int        `json:"songs_updated"`
+		Skipped    int        `json:"songs_skipped"`
+		Failed     int        `json:"songs_failed"`
+		LastError  *string    `json:"last_error"`
+		StartedAt  time.Time  `json:"started_at"`
+		FinishedAt *time.Time `json:"finished_at"`
+	}
+)
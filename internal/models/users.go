@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+type (
+	User struct {
+		ID        int       `json:"user_id"`
+		Email     string    `json:"email"`
+		Role      string    `json:"role"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// Credentials are sent to register and to log in.
+	Credentials struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	// Session is a login, every refresh token of it shares the session ID.
+	// Revoking the session logs the user out.
+	Session struct {
+		ID     string
+		UserID int
+		// Role is the current role of the user.
+		Role      string
+		RevokedAt *time.Time
+	}
+
+	TokenPair struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		// ExpiresIn is the lifetime of the access token in seconds.
+		ExpiresIn int `json:"expires_in"`
+	}
+
+	RefreshRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+)
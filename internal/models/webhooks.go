@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Webhook delivery statuses.
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusRunning   = "running"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+type (
+	WebhookSubscription struct {
+		ID  int    `json:"subscription_id"`
+		URL string `json:"url"`
+		// Secret is only returned when the subscription is created.
+		Secret     string    `json:"secret,omitempty"`
+		EventTypes []string  `json:"event_types"`
+		Active     bool      `json:"active"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+
+	NewWebhookRequest struct {
+		URL string `json:"url"`
+		// Secret signs the deliveries, a random one is generated if it is empty.
+		Secret string `json:"secret,omitempty"`
+		// EventTypes filters the events, empty means all of them.
+		EventTypes []string `json:"event_types,omitempty"`
+	}
+
+	WebhookDelivery struct {
+		ID             int        `json:"delivery_id"`
+		SubscriptionID int        `json:"subscription_id"`
+		EventID        string     `json:"event_id"`
+		EventType      string     `json:"event_type"`
+		Status         string     `json:"status"`
+		Attempts       int        `json:"attempts"`
+		MaxAttempts    int        `json:"max_attempts"`
+		ResponseStatus *int       `json:"response_status"`
+		LastError      *string    `json:"last_error"`
+		NextAttemptAt  time.Time  `json:"next_attempt_at"`
+		DeliveredAt    *time.Time `json:"delivered_at"`
+		CreatedAt      time.Time  `json:"created_at"`
+		UpdatedAt      time.Time  `json:"updated_at"`
+
+		// Set on claimed deliveries only.
+		URL     string `json:"-"`
+		Secret  string `json:"-"`
+		Payload []byte `json:"-"`
+	}
+)
@@ -0,0 +1,78 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/lib/pq"
+)
+
+// Listener receives the events a PostgresPublisher sends, from this or any
+// other instance, and hands them to a local publisher. Events sent while the
+// connection is down are missed.
+type Listener struct {
+	dsn       string
+	channel   string
+	publisher Publisher
+	wg        sync.WaitGroup
+}
+
+func NewListener(dsn, channel string, publisher Publisher) *Listener {
+	return &Listener{dsn: dsn, channel: channel, publisher: publisher}
+}
+
+// Start listens until ctx is cancelled, Wait blocks until it has stopped.
+func (l *Listener) Start(ctx context.Context) error {
+	listener := pq.NewListener(l.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("Event listener connection problem", slog.String("channel", l.channel), slog.Any("error", err))
+		}
+	})
+	if err := listener.Listen(l.channel); err != nil {
+		listener.Close()
+		return err
+	}
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		defer listener.Close()
+		l.loop(ctx, listener)
+	}()
+	return nil
+}
+
+func (l *Listener) Wait() {
+	l.wg.Wait()
+}
+
+func (l *Listener) loop(ctx context.Context, listener *pq.Listener) {
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			// nil follows a reconnect.
+			if n == nil {
+				continue
+			}
+			var event models.Event
+			if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+				slog.Warn("Ignoring malformed event notification", slog.Any("error", err))
+				continue
+			}
+			if err := l.publisher.Publish(ctx, event); err != nil {
+				slog.Warn("Failed to pass on event", slog.String("event_id", event.ID), slog.Any("error", err))
+			}
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+// PostgresPublisher sends events as JSON with NOTIFY on a channel, any
+// connection that ran LISTEN on it receives them.
+type PostgresPublisher struct {
+	db      *sql.DB
+	channel string
+}
+
+func NewPostgresPublisher(db *sql.DB, channel string) *PostgresPublisher {
+	return &PostgresPublisher{db: db, channel: channel}
+}
+
+func (p *PostgresPublisher) Publish(ctx context.Context, event models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	if _, err := p.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", p.channel, string(payload)); err != nil {
+		return fmt.Errorf("notify %s: %w", p.channel, err)
+	}
+	return nil
+}
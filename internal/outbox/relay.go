@@ -0,0 +1,133 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	// Publisher receives the events leaving the outbox. An event whose
+	// Publish failed is offered again, so publishers must tolerate duplicates.
+	Publisher interface {
+		Publish(ctx context.Context, event models.Event) error
+	}
+
+	Store interface {
+		RelayBatch(ctx context.Context, limit int, publish func(models.Event) error) (int, error)
+		DeletePublished(ctx context.Context, before time.Time) (int, error)
+	}
+
+	Config struct {
+		PollInterval time.Duration
+		BatchSize    int
+		// Retention is how long published events are kept, zero keeps them forever.
+		Retention time.Duration
+	}
+
+	// Relay moves events from the outbox to the publisher in the order they
+	// were written. An event is marked published only after the publisher
+	// accepted it, so every event is delivered at least once.
+	Relay struct {
+		store     Store
+		publisher Publisher
+		cfg       Config
+		wg        sync.WaitGroup
+	}
+)
+
+func NewRelay(store Store, publisher Publisher, cfg Config) *Relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 500 * time.Millisecond
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		cfg:       cfg,
+	}
+}
+
+// Start runs the relay until ctx is cancelled, Wait blocks until it has stopped.
+func (r *Relay) Start(ctx context.Context) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.loop(ctx)
+	}()
+}
+
+func (r *Relay) Wait() {
+	r.wg.Wait()
+}
+
+func (r *Relay) loop(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	lastCleanup := time.Now()
+	for {
+		// Keep going while full batches come back.
+		for ctx.Err() == nil && r.relayBatch(ctx) == r.cfg.BatchSize {
+		}
+
+		if r.cfg.Retention > 0 && time.Since(lastCleanup) > time.Hour {
+			r.cleanup(ctx)
+			lastCleanup = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) relayBatch(ctx context.Context) int {
+	n, err := r.store.RelayBatch(ctx, r.cfg.BatchSize, func(event models.Event) error {
+		return r.publisher.Publish(ctx, event)
+	})
+	if err != nil && ctx.Err() == nil {
+		slog.Warn("Failed to relay outbox events, will retry", slog.Int("published", n), slog.Any("error", err))
+	} else if n > 0 {
+		slog.Debug("Outbox events relayed", slog.Int("published", n))
+	}
+	if err != nil {
+		// Wait for the next tick before retrying.
+		return 0
+	}
+	return n
+}
+
+func (r *Relay) cleanup(ctx context.Context) {
+	n, err := r.store.DeletePublished(ctx, time.Now().Add(-r.cfg.Retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to delete published outbox events", slog.Any("error", err))
+		}
+		return
+	}
+	if n > 0 {
+		slog.Info("Published outbox events deleted", slog.Int("deleted", n))
+	}
+}
+
+// Fanout publishes every event to all publishers in turn. It fails if any of
+// them fails; those that succeeded will see the event again on retry.
+type Fanout []Publisher
+
+func (f Fanout) Publish(ctx context.Context, event models.Event) error {
+	for _, p := range f {
+		if err := p.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+// memoryStore is an outbox that hands out unpublished events in order, like
+// OutboxRepository.RelayBatch.
+type memoryStore struct {
+	events    []models.Event
+	published int
+}
+
+func (s *memoryStore) RelayBatch(_ context.Context, limit int, publish func(models.Event) error) (int, error) {
+	n := 0
+	for _, event := range s.events[s.published:min(len(s.events), s.published+limit)] {
+		if err := publish(event); err != nil {
+			return n, err
+		}
+		s.published++
+		n++
+	}
+	return n, nil
+}
+
+func (s *memoryStore) DeletePublished(context.Context, time.Time) (int, error) {
+	return 0, nil
+}
+
+func eventIDs(events []models.Event) []string {
+	var ids []string
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestRelayPublishesInOrder(t *testing.T) {
+	store := &memoryStore{events: []models.Event{{ID: "1"}, {ID: "2"}, {ID: "3"}, {ID: "4"}, {ID: "5"}}}
+	publisher := NewMemoryPublisher()
+	relay := NewRelay(store, publisher, Config{BatchSize: 2})
+
+	if n := relay.relayBatch(context.Background()); n != 2 {
+		t.Fatalf("first batch relayed %d events, want 2", n)
+	}
+
+	// A failing publisher stops the batch, nothing is skipped.
+	publisher.Fail(errors.New("down"))
+	if n := relay.relayBatch(context.Background()); n != 0 {
+		t.Fatalf("failing batch relayed %d events, want 0", n)
+	}
+	publisher.Fail(nil)
+
+	for relay.relayBatch(context.Background()) > 0 {
+	}
+
+	if got, want := eventIDs(publisher.Events()), []string{"1", "2", "3", "4", "5"}; !slices.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+func TestFanout(t *testing.T) {
+	first, second := NewMemoryPublisher(), NewMemoryPublisher()
+	second.Fail(errors.New("down"))
+	fanout := Fanout{first, second}
+
+	if err := fanout.Publish(context.Background(), models.Event{ID: "1"}); err == nil {
+		t.Fatal("fanout ignored a failing publisher")
+	}
+	second.Fail(nil)
+	if err := fanout.Publish(context.Background(), models.Event{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first publisher sees the retried event twice.
+	if got := eventIDs(first.Events()); !slices.Equal(got, []string{"1", "1"}) {
+		t.Errorf("first publisher got %v", got)
+	}
+	if got := eventIDs(second.Events()); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("second publisher got %v", got)
+	}
+}
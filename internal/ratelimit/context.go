@@ -0,0 +1,24 @@
+package ratelimit
+
+import "context"
+
+type spenderKey struct{}
+
+// Spender takes a token from a budget of the client of a request.
+type Spender func(ctx context.Context, budget string) error
+
+// WithSpender returns a context whose requests can be charged with Spend.
+func WithSpender(ctx context.Context, spend Spender) context.Context {
+	return context.WithValue(ctx, spenderKey{}, spend)
+}
+
+// Spend charges the client of the request for a budget that only some paths
+// of a route need, e.g. Upstream for adds that call the provider. It returns
+// an apperrors.ErrRateLimited error when the budget is exhausted and nil when
+// ctx belongs to no rate limited request.
+func Spend(ctx context.Context, budget string) error {
+	if spend, ok := ctx.Value(spenderKey{}).(Spender); ok {
+		return spend(ctx, budget)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Budgets of a client. Every request takes a token from each budget of its
+// route, calls that may reach the song detail provider also take one from
+// Upstream.
+const (
+	Read     = "read"
+	Write    = "write"
+	Upstream = "upstream"
+)
+
+type (
+	// Limit is a token bucket: it holds up to Burst tokens and refills at
+	// Rate tokens per second.
+	Limit struct {
+		Rate  float64
+		Burst int
+	}
+
+	// Result describes a bucket after taking a token from it.
+	Result struct {
+		Allowed   bool
+		Limit     int
+		Remaining int
+		// Reset is the time until the bucket is full again.
+		Reset time.Duration
+		// RetryAfter is the time until the next token, zero if allowed.
+		RetryAfter time.Duration
+	}
+
+	// Store keeps the buckets. Refund puts back a token taken by Take.
+	Store interface {
+		Take(ctx context.Context, key string, limit Limit) (Result, error)
+		Refund(ctx context.Context, key string, limit Limit) error
+	}
+
+	Limiter struct {
+		store  Store
+		limits map[string]Limit
+	}
+)
+
+func NewLimiter(store Store, limits map[string]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits}
+}
+
+// Allow takes a token from the client's budget. Budgets without a limit are
+// unlimited.
+func (l *Limiter) Allow(ctx context.Context, budget, client string) (Result, error) {
+	limit, ok := l.limits[budget]
+	if !ok || limit.Rate <= 0 || limit.Burst <= 0 {
+		return Result{Allowed: true}, nil
+	}
+	return l.store.Take(ctx, budget+":"+client, limit)
+}
+
+// Refund returns a token taken by Allow, for requests refused by another
+// budget.
+func (l *Limiter) Refund(ctx context.Context, budget, client string) error {
+	limit, ok := l.limits[budget]
+	if !ok || limit.Rate <= 0 || limit.Burst <= 0 {
+		return nil
+	}
+	return l.store.Refund(ctx, budget+":"+client, limit)
+}
+
+// refill returns the tokens in a bucket after elapsed time.
+func (l Limit) refill(tokens float64, elapsed time.Duration) float64 {
+	return math.Min(float64(l.Burst), tokens+elapsed.Seconds()*l.Rate)
+}
+
+// result describes a bucket left with tokens.
+func (l Limit) result(tokens float64, allowed bool) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     l.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     l.wait(float64(l.Burst) - tokens),
+	}
+	if !allowed {
+		r.RetryAfter = l.wait(1 - tokens)
+	}
+	return r
+}
+
+// wait returns how long refilling the given number of tokens takes.
+func (l Limit) wait(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.Rate * float64(time.Second))
+}
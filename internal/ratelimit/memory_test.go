@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 2}
+
+	// A step takes a token after advancing the clock, or refunds one.
+	type step struct {
+		advance    time.Duration
+		refund     bool
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "burst then empty",
+			steps: []step{
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0},
+				{allowed: false, remaining: 0, retryAfter: time.Second},
+			},
+		},
+		{
+			name: "refills at the rate",
+			steps: []step{
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0},
+				{advance: 500 * time.Millisecond, allowed: false, retryAfter: 500 * time.Millisecond},
+				{advance: 500 * time.Millisecond, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name: "refill stops at the burst",
+			steps: []step{
+				{allowed: true, remaining: 1},
+				{advance: time.Hour, allowed: true, remaining: 1},
+			},
+		},
+		{
+			name: "refund gives a token back",
+			steps: []step{
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0},
+				{refund: true},
+				{allowed: true, remaining: 0},
+				{allowed: false, retryAfter: time.Second},
+			},
+		},
+		{
+			name: "refund stops at the burst",
+			steps: []step{
+				{allowed: true, remaining: 1},
+				{refund: true},
+				{refund: true},
+				{allowed: true, remaining: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			store := NewMemoryStore()
+			store.now = func() time.Time { return now }
+			store.lastSweep = now
+
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				if s.refund {
+					if err := store.Refund(context.Background(), "client", limit); err != nil {
+						t.Fatalf("step %d: refund: %v", i, err)
+					}
+					continue
+				}
+
+				r, err := store.Take(context.Background(), "client", limit)
+				if err != nil {
+					t.Fatalf("step %d: take: %v", i, err)
+				}
+				if r.Allowed != s.allowed || r.Remaining != s.remaining || r.RetryAfter != s.retryAfter {
+					t.Fatalf("step %d: got allowed %v, remaining %d, retry after %s; want %v, %d, %s",
+						i, r.Allowed, r.Remaining, r.RetryAfter, s.allowed, s.remaining, s.retryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeysAreSeparate(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 1}
+
+	if r, _ := store.Take(context.Background(), "a", limit); !r.Allowed {
+		t.Fatal("first take of a refused")
+	}
+	if r, _ := store.Take(context.Background(), "b", limit); !r.Allowed {
+		t.Error("b refused after a used its bucket")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	store.lastSweep = now
+	limit := Limit{Rate: 1, Burst: 5}
+
+	store.Take(context.Background(), "idle", limit)
+	now = now.Add(2 * sweepInterval)
+	store.Take(context.Background(), "busy", limit)
+
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("full bucket not swept")
+	}
+	if _, ok := store.buckets["busy"]; !ok {
+		t.Error("bucket in use swept")
+	}
+}
+
+func TestLimiterUnlimitedBudgets(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), map[string]Limit{
+		Read:  {Rate: 0, Burst: 10},
+		Write: {Rate: 1, Burst: 0},
+	})
+
+	for _, budget := range []string{Read, Write, Upstream} {
+		for i := 0; i < 100; i++ {
+			if r, err := limiter.Allow(context.Background(), budget, "client"); err != nil || !r.Allowed {
+				t.Fatalf("%s: request %d refused (%v)", budget, i, err)
+			}
+		}
+	}
+}
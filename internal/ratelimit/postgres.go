@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// idleBucket is how long a bucket stays unused before it is deleted. By then
+// it is full with any sensible limit and is recreated full anyway.
+const idleBucket = 24 * time.Hour
+
+// PostgresStore keeps the buckets in the rate_limits table so every instance
+// shares them. Each take is a single upsert, concurrent requests for the
+// same bucket queue on its row.
+type PostgresStore struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db, lastSweep: time.Now()}
+}
+
+func (p *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	p.maybeSweep(ctx)
+
+	// The refilled amount is computed from the locked row, so the bucket is
+	// never read and written by two requests at once.
+	query := `
+		INSERT INTO rate_limits AS b (bucket_key, tokens, allowed, updated_at)
+		VALUES ($1, $2::double precision - 1, true, now())
+		ON CONFLICT (bucket_key) DO UPDATE
+		SET (tokens, allowed, updated_at) = (
+			SELECT CASE WHEN r.tokens >= 1 THEN r.tokens - 1 ELSE r.tokens END, r.tokens >= 1, now()
+			FROM (
+				SELECT LEAST($2::double precision, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::double precision) AS tokens
+			) AS r
+		)
+		RETURNING tokens, allowed`
+
+	var (
+		tokens  float64
+		allowed bool
+	)
+	if err := p.db.QueryRowContext(ctx, query, key, limit.Burst, limit.Rate).Scan(&tokens, &allowed); err != nil {
+		return Result{}, errors.Wrap(err, "take token")
+	}
+	return limit.result(tokens, allowed), nil
+}
+
+func (p *PostgresStore) Refund(ctx context.Context, key string, limit Limit) error {
+	query := `UPDATE rate_limits SET tokens = LEAST($2::double precision, tokens + 1) WHERE bucket_key = $1`
+	_, err := p.db.ExecContext(ctx, query, key, limit.Burst)
+	return errors.Wrap(err, "refund token")
+}
+
+// maybeSweep deletes idle buckets, at most once a minute per instance.
+func (p *PostgresStore) maybeSweep(ctx context.Context) {
+	p.mu.Lock()
+	if time.Since(p.lastSweep) < sweepInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastSweep = time.Now()
+	p.mu.Unlock()
+
+	query := `DELETE FROM rate_limits WHERE updated_at < now() - $1::double precision * interval '1 second'`
+	if _, err := p.db.ExecContext(ctx, query, idleBucket.Seconds()); err != nil {
+		slog.Warn("Failed to delete idle rate limit buckets", slog.Any("error", err))
+	}
+}
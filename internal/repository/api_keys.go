@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+type APIKeyRepository struct {
+	db instrumentedDB
+}
+
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: instrument(db)}
+}
+
+const apiKeyColumns = `key_id, name, prefix, scopes, created_at, last_used_at, revoked_at`
+
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, key *models.APIKey, hash string) error {
+	query := `INSERT INTO api_keys (name, prefix, key_hash, scopes) VALUES ($1, $2, $3, $4) RETURNING key_id, created_at`
+	err := r.db.QueryRowContext(ctx, query, key.Name, key.Prefix, hash, pq.Array(key.Scopes)).Scan(&key.ID, &key.CreatedAt)
+	return errors.Wrap(err, "create api key")
+}
+
+// GetAPIKeyByHash finds a key that has not been revoked.
+func (r *APIKeyRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("api_key_not_found", "no such api key")
+		}
+		return nil, errors.Wrap(err, "fetch api key")
+	}
+	return key, nil
+}
+
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY key_id`)
+	if err != nil {
+		return nil, errors.Wrap(err, "list api keys")
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan api key")
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *APIKeyRepository) RevokeAPIKey(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = now() WHERE key_id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return errors.Wrap(err, "revoke api key")
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+	if rowsAffected == 0 {
+		return apperrors.NotFound("api_key_not_found", "no active api key found with ID %d", id)
+	}
+	return nil
+}
+
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = now() WHERE key_id = $1`, id)
+	return errors.Wrap(err, "touch api key")
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/metrics"
+	"github.com/KarmaBeLike/SongLibrary/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type (
+	// instrumentedDB records the duration and errors of every statement run
+	// through it, transactions it starts included, and traces it.
+	instrumentedDB struct {
+		*sql.DB
+	}
+
+	instrumentedTx struct {
+		*sql.Tx
+	}
+
+	instrumentedRow struct {
+		*sql.Row
+		done func(error)
+	}
+)
+
+func instrument(db *sql.DB) instrumentedDB {
+	return instrumentedDB{DB: db}
+}
+
+func (db instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := statement(ctx, query)
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	done(err)
+	return result, err
+}
+
+func (db instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := statement(ctx, query)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	done(err)
+	return rows, err
+}
+
+// QueryRowContext records the statement when the row is scanned, only then
+// are its errors known and the row read.
+func (db instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *instrumentedRow {
+	ctx, done := statement(ctx, query)
+	return &instrumentedRow{Row: db.DB.QueryRowContext(ctx, query, args...), done: done}
+}
+
+func (db instrumentedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (instrumentedTx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	return instrumentedTx{Tx: tx}, err
+}
+
+func (tx instrumentedTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := statement(ctx, query)
+	result, err := tx.Tx.ExecContext(ctx, query, args...)
+	done(err)
+	return result, err
+}
+
+func (tx instrumentedTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := statement(ctx, query)
+	rows, err := tx.Tx.QueryContext(ctx, query, args...)
+	done(err)
+	return rows, err
+}
+
+// QueryRowContext records the statement when the row is scanned, only then
+// are its errors known and the row read.
+func (tx instrumentedTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *instrumentedRow {
+	ctx, done := statement(ctx, query)
+	return &instrumentedRow{Row: tx.Tx.QueryRowContext(ctx, query, args...), done: done}
+}
+
+func (r *instrumentedRow) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	r.done(err)
+	return err
+}
+
+// statement starts a span for the query. The returned function records its
+// duration and ends the span. sql.ErrNoRows is an answer, not a failure.
+func statement(ctx context.Context, query string) (context.Context, func(error)) {
+	op := operation(query)
+	ctx, span := tracing.Start(ctx, op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(strings.Fields(op)[0]),
+			semconv.DBQueryText(query),
+		),
+	)
+	start := time.Now()
+
+	return ctx, func(err error) {
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+		metrics.ObserveQuery(op, time.Since(start), err)
+		tracing.End(span, err)
+	}
+}
+
+var operations sync.Map
+
+// operation names a statement by its verb and first table, e.g. "select
+// songs" or "insert outbox", which keeps the metric labels few.
+func operation(query string) string {
+	if op, ok := operations.Load(query); ok {
+		return op.(string)
+	}
+	op := nameStatement(query)
+	operations.Store(query, op)
+	return op
+}
+
+func nameStatement(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+
+	verb := strings.ToLower(fields[0])
+	for i := 0; i < len(fields)-1; i++ {
+		switch strings.ToUpper(fields[i]) {
+		case "FROM", "INTO", "UPDATE":
+			if table := strings.Trim(fields[i+1], "(),;"); table != "" && !strings.HasPrefix(table, "$") {
+				return verb + " " + strings.ToLower(table)
+			}
+		}
+	}
+	return verb
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/pkg/errors"
+)
+
+type JobRepository struct {
+	db instrumentedDB
+}
+
+func NewJobRepository(db *sql.DB) *JobRepository {
+	return &JobRepository{db: instrument(db)}
+}
+
+const jobColumns = `job_id, song_id, status, attempts, max_attempts, last_error, next_attempt_at, created_at, updated_at`
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (*models.EnrichmentJob, error) {
+	var job models.EnrichmentJob
+	err := row.Scan(&job.ID, &job.SongID, &job.Status, &job.Attempts, &job.MaxAttempts, &job.LastError, &job.NextAttemptAt, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *JobRepository) GetJobByID(ctx context.Context, id int) (*models.EnrichmentJob, error) {
+	query := `SELECT ` + jobColumns + ` FROM enrichment_jobs WHERE job_id = $1`
+
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("job_not_found", "no job found with ID %d", id)
+		}
+		logging.FromContext(ctx).Error("Error fetching job by ID", slog.Any("error", err))
+		return nil, errors.Wrap(err, "fetch job")
+	}
+	return job, nil
+}
+
+// ClaimJob takes the next due job and leases it to owner for the given time.
+// Jobs whose lease ran out, e.g. because the worker crashed, are taken again.
+// It returns nil when there is nothing to do.
+func (r *JobRepository) ClaimJob(ctx context.Context, owner string, lease time.Duration) (*models.EnrichmentJob, error) {
+	query := `
+		UPDATE enrichment_jobs
+		SET status = $1, attempts = attempts + 1, locked_by = $4, locked_until = now() + $2::double precision * interval '1 millisecond', updated_at = now()
+		WHERE job_id = (
+			SELECT job_id FROM enrichment_jobs
+			WHERE (status = $3 AND next_attempt_at <= now())
+				OR (status = $1 AND locked_until < now())
+			ORDER BY next_attempt_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, models.JobStatusRunning, lease.Milliseconds(), models.JobStatusQueued, owner))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "claim job")
+	}
+	return job, nil
+}
+
+// CompleteJob, RetryJob and FailJob only change a job whose lease owner
+// still holds. Once it ran out, the job may already run elsewhere, and they
+// return a conflict.
+func (r *JobRepository) CompleteJob(ctx context.Context, id int, owner string) error {
+	query := `UPDATE enrichment_jobs SET status = $1, last_error = NULL, locked_by = NULL, locked_until = NULL, updated_at = now() WHERE job_id = $2 AND locked_by = $3 AND locked_until > now()`
+	result, err := r.db.ExecContext(ctx, query, models.JobStatusSucceeded, id, owner)
+	if err != nil {
+		return errors.Wrap(err, "complete job")
+	}
+	return leaseLost(result, "job", id)
+}
+
+// RetryJob puts the job back in the queue until nextAttempt.
+func (r *JobRepository) RetryJob(ctx context.Context, id int, owner string, nextAttempt time.Time, lastError string) error {
+	query := `UPDATE enrichment_jobs SET status = $1, last_error = $2, next_attempt_at = $3, locked_by = NULL, locked_until = NULL, updated_at = now() WHERE job_id = $4 AND locked_by = $5 AND locked_until > now()`
+	result, err := r.db.ExecContext(ctx, query, models.JobStatusQueued, lastError, nextAttempt, id, owner)
+	if err != nil {
+		return errors.Wrap(err, "retry job")
+	}
+	return leaseLost(result, "job", id)
+}
+
+// FailJob gives up on the job and marks its song as failed.
+func (r *JobRepository) FailJob(ctx context.Context, id, songID int, owner, lastError string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE enrichment_jobs SET status = $1, last_error = $2, locked_by = NULL, locked_until = NULL, updated_at = now() WHERE job_id = $3 AND locked_by = $4 AND locked_until > now()`
+	result, err := tx.ExecContext(ctx, query, models.JobStatusFailed, lastError, id, owner)
+	if err != nil {
+		return errors.Wrap(err, "fail job")
+	}
+	if err := leaseLost(result, "job", id); err != nil {
+		return err
+	}
+
+	// The song may have been deleted or completed meanwhile, then nothing changes.
+	event := models.Event{Type: models.EventSongUpdated, SongID: songID, Fields: []string{models.FieldStatus}}
+	songQuery := `UPDATE songs SET status = $1 WHERE song_id = $2 AND status = $3 RETURNING group_id, group_name`
+	err = tx.QueryRowContext(ctx, songQuery, models.SongStatusFailed, songID, models.SongStatusPending).Scan(&event.GroupID, &event.Group)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return errors.Wrap(err, "mark song failed")
+	default:
+		if err := insertEvent(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "commit transaction")
+}
+
+// leaseLost turns an update of a leased row that changed nothing into a
+// conflict: the lease ran out and the row may belong to another worker.
+func leaseLost(result sql.Result, what string, id int) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+	if n == 0 {
+		return apperrors.Conflict("lease_lost", "%s %d is no longer leased to this worker", what, id)
+	}
+	return nil
+}
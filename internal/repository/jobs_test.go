@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+)
+
+// rowsResult is an sql.Result that reports a fixed number of changed rows.
+type rowsResult struct {
+	rows int64
+	err  error
+}
+
+func (r rowsResult) LastInsertId() (int64, error) { return 0, errors.New("not supported") }
+func (r rowsResult) RowsAffected() (int64, error) { return r.rows, r.err }
+
+func TestLeaseLost(t *testing.T) {
+	errDriver := errors.New("driver failed")
+
+	tests := []struct {
+		name   string
+		result rowsResult
+		want   error
+	}{
+		{"lease held", rowsResult{rows: 1}, nil},
+		{"lease ran out", rowsResult{rows: 0}, apperrors.ErrConflict},
+		{"driver error", rowsResult{err: errDriver}, errDriver},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := leaseLost(tt.result, "job", 7)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if appErr, ok := apperrors.As(err); ok && appErr.Code != "lease_lost" {
+				t.Errorf("code = %q, want lease_lost", appErr.Code)
+			}
+		})
+	}
+}
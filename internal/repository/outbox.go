@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// outboxLockKey is the advisory lock that lets only one relay publish at a
+// time, so events leave the outbox in order.
+const outboxLockKey = 0x536f6e674c6962 // "SongLib"
+
+type OutboxRepository struct {
+	db instrumentedDB
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: instrument(db)}
+}
+
+// insertEvent stores a change event in the outbox. It must run in the
+// transaction of the change.
+func insertEvent(ctx context.Context, q querier, event models.Event) error {
+	if event.ID == "" {
+		id, err := newEventID()
+		if err != nil {
+			return err
+		}
+		event.ID = id
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "encode event")
+	}
+
+	query := "INSERT INTO outbox (event_id, event_type, payload) VALUES ($1, $2, $3)"
+	if _, err := q.ExecContext(ctx, query, event.ID, event.Type, payload); err != nil {
+		return errors.Wrap(err, "insert outbox event")
+	}
+	return nil
+}
+
+// RelayBatch hands up to limit unpublished events to publish in order and
+// marks those it accepted as published. It stops at the first event publish
+// fails on, which is tried again by the next batch. It returns the number of
+// published events; zero with a nil error also means another relay holds
+// the outbox.
+func (r *OutboxRepository) RelayBatch(ctx context.Context, limit int, publish func(models.Event) error) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", outboxLockKey).Scan(&locked); err != nil {
+		return 0, errors.Wrap(err, "lock outbox")
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	entries, err := pendingEvents(ctx, tx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	published, publishErr := publishInOrder(entries, publish)
+	if len(published) > 0 {
+		query := "UPDATE outbox SET published_at = now() WHERE outbox_id = ANY($1)"
+		if _, err := tx.ExecContext(ctx, query, pq.Array(published)); err != nil {
+			return 0, errors.Wrap(err, "mark outbox events published")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "commit transaction")
+	}
+	return len(published), publishErr
+}
+
+// publishInOrder hands the entries to publish until it fails and returns the
+// IDs of those it accepted.
+func publishInOrder(entries []models.OutboxEntry, publish func(models.Event) error) ([]int64, error) {
+	var published []int64
+	for _, entry := range entries {
+		if err := publish(entry.Event); err != nil {
+			return published, err
+		}
+		published = append(published, entry.ID)
+	}
+	return published, nil
+}
+
+// pendingEvents returns the oldest unpublished events of finished
+// transactions. A transaction still in flight may hold a smaller outbox_id
+// than rows already committed; rows of it and of every later transaction
+// wait until the oldest one running has ended.
+func pendingEvents(ctx context.Context, q querier, limit int) ([]models.OutboxEntry, error) {
+	query := `
+		SELECT outbox_id, payload FROM outbox
+		WHERE published_at IS NULL AND xid < pg_snapshot_xmin(pg_current_snapshot())
+		ORDER BY outbox_id
+		LIMIT $1`
+	rows, err := q.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "query outbox")
+	}
+	defer rows.Close()
+
+	var entries []models.OutboxEntry
+	for rows.Next() {
+		var (
+			entry   models.OutboxEntry
+			payload []byte
+		)
+		if err := rows.Scan(&entry.ID, &payload); err != nil {
+			return nil, errors.Wrap(err, "scan outbox event")
+		}
+		if err := json.Unmarshal(payload, &entry.Event); err != nil {
+			return nil, errors.Wrapf(err, "decode outbox event %d", entry.ID)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// DeletePublished removes events published before the given time.
+func (r *OutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM outbox WHERE published_at < $1", before)
+	if err != nil {
+		return 0, errors.Wrap(err, "delete published outbox events")
+	}
+	n, err := result.RowsAffected()
+	return int(n), errors.Wrap(err, "rows affected")
+}
+
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generate event id")
+	}
+	return hex.EncodeToString(b), nil
+}
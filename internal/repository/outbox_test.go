@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+func TestPublishInOrder(t *testing.T) {
+	errDown := errors.New("publisher down")
+	entries := []models.OutboxEntry{
+		{ID: 1, Event: models.Event{ID: "a"}},
+		{ID: 2, Event: models.Event{ID: "b"}},
+		{ID: 3, Event: models.Event{ID: "c"}},
+	}
+
+	tests := []struct {
+		name      string
+		failOn    string
+		published []int64
+		sent      []string
+	}{
+		{name: "all accepted", published: []int64{1, 2, 3}, sent: []string{"a", "b", "c"}},
+		{name: "stops at the first failure", failOn: "b", published: []int64{1}, sent: []string{"a", "b"}},
+		{name: "first fails", failOn: "a", sent: []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []string
+			published, err := publishInOrder(entries, func(event models.Event) error {
+				sent = append(sent, event.ID)
+				if event.ID == tt.failOn {
+					return errDown
+				}
+				return nil
+			})
+
+			if !slices.Equal(published, tt.published) {
+				t.Errorf("published = %v, want %v", published, tt.published)
+			}
+			if !slices.Equal(sent, tt.sent) {
+				t.Errorf("sent = %v, want %v", sent, tt.sent)
+			}
+			if wantErr := tt.failOn != ""; (err != nil) != wantErr {
+				t.Errorf("err = %v, want error %v", err, wantErr)
+			}
+		})
+	}
+}
@@ -5,25 +5,47 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
-	"time"
 
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
 	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/KarmaBeLike/SongLibrary/internal/tracing"
+	"github.com/KarmaBeLike/SongLibrary/pkg/releasedate"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
-type SongRepository struct {
-	db *sql.DB
-}
+const (
+	uniqueViolation       = "23505"
+	invalidDatetimeFormat = "22007"
+	datetimeFieldOverflow = "22008"
+)
+
+type (
+	SongRepository struct {
+		db instrumentedDB
+	}
+
+	// querier is satisfied by both instrumentedDB and instrumentedTx.
+	querier interface {
+		ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+		QueryRowContext(ctx context.Context, query string, args ...interface{}) *instrumentedRow
+	}
+)
 
 func NewSongRepository(db *sql.DB) *SongRepository {
-	return &SongRepository{db: db}
+	return &SongRepository{db: instrument(db)}
 }
 
 func (r *SongRepository) GetSongByID(ctx context.Context, id int) (models.Song, error) {
-	slog.Debug("Fetching song by ID", slog.Int("id", id))
+	ctx, span := tracing.Start(ctx, "SongRepository.GetSongByID")
+	defer span.End()
+
+	logging.FromContext(ctx).Debug("Fetching song by ID", slog.Int("id", id))
 
-	var song models.Song
 	query := `
 		SELECT 
 			song_id, 
@@ -31,25 +53,30 @@ func (r *SongRepository) GetSongByID(ctx context.Context, id int) (models.Song,
 			song, 
 			lyrics, 
 			release_date, 
-			link 
+			release_date_precision,
+			link,
+			status
 		FROM songs 
 		WHERE song_id = $1
 	`
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&song.ID, &song.Group, &song.Song, &song.Text, &song.ReleaseDate, &song.Link)
+	song, err := scanSong(r.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			slog.Info("No song found with ID", slog.Int("id", id))
-			return models.Song{}, fmt.Errorf("no song found with ID %d", id)
+			logging.FromContext(ctx).Info("No song found with ID", slog.Int("id", id))
+			return models.Song{}, apperrors.NotFound("song_not_found", "no song found with ID %d", id)
 		}
-		slog.Error("Error fetching song by ID", slog.Any("error", err))
+		logging.FromContext(ctx).Error("Error fetching song by ID", slog.Any("error", err))
 		return models.Song{}, err
 	}
-	slog.Info("Song fetched successfully", slog.Int("id", id))
+	logging.FromContext(ctx).Info("Song fetched successfully", slog.Int("id", id))
 	return song, nil
 }
 
 func (r *SongRepository) GetSongsByFilter(ctx context.Context, filter models.SongFilter) ([]models.Song, error) {
-	query := `SELECT  song_id,group_name, song, lyrics, release_date, link FROM songs WHERE 1=1`
+	ctx, span := tracing.Start(ctx, "SongRepository.GetSongsByFilter")
+	defer span.End()
+
+	query := `SELECT  song_id,group_name, song, lyrics, release_date, release_date_precision, link, status FROM songs WHERE 1=1`
 	args := []interface{}{}
 	paramIndex := 1
 
@@ -78,12 +105,17 @@ func (r *SongRepository) GetSongsByFilter(ctx context.Context, filter models.Son
 	}
 
 	if filter.ReleaseDate != "" {
-		query += fmt.Sprintf(" AND release_date = $%d", paramIndex)
-		args = append(args, filter.ReleaseDate)
-		paramIndex++
+		// A filter known to a month or a year matches every date in it.
+		date, err := releasedate.Parse(filter.ReleaseDate)
+		if err != nil {
+			return nil, apperrors.Validation("invalid_release_date", "%v", err).Wrap(err)
+		}
+		query += fmt.Sprintf(" AND release_date >= $%d AND release_date < $%d", paramIndex, paramIndex+1)
+		args = append(args, date.Time, date.End())
+		paramIndex += 2
 	}
 
-	slog.Debug("Executing query", slog.String("query", query), slog.Any("args", args))
+	logging.FromContext(ctx).Debug("Executing query", slog.String("query", query), slog.Any("args", args))
 
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -93,8 +125,8 @@ func (r *SongRepository) GetSongsByFilter(ctx context.Context, filter models.Son
 
 	var songs []models.Song
 	for rows.Next() {
-		var song models.Song
-		if err := rows.Scan(&song.ID, &song.Group, &song.Song, &song.Text, &song.ReleaseDate, &song.Link); err != nil {
+		song, err := scanSong(rows)
+		if err != nil {
 			return nil, err
 		}
 		songs = append(songs, song)
@@ -103,94 +135,173 @@ func (r *SongRepository) GetSongsByFilter(ctx context.Context, filter models.Son
 }
 
 func (r *SongRepository) DeleteSongByID(ctx context.Context, id int) error {
-	slog.Debug("Deleting song by ID", slog.Int("id", id))
+	ctx, span := tracing.Start(ctx, "SongRepository.DeleteSongByID")
+	defer span.End()
+
+	logging.FromContext(ctx).Debug("Deleting song by ID", slog.Int("id", id))
 
-	query := "DELETE FROM songs WHERE song_id = $1"
-	result, err := r.db.ExecContext(ctx, query, id)
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		slog.Error("Error executing delete query", slog.Any("error", err))
+		return errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	event := models.Event{Type: models.EventSongDeleted, SongID: id}
+	query := "DELETE FROM songs WHERE song_id = $1 RETURNING group_id, group_name"
+	if err := tx.QueryRowContext(ctx, query, id).Scan(&event.GroupID, &event.Group); err != nil {
+		if err == sql.ErrNoRows {
+			return apperrors.NotFound("song_not_found", "no song found with ID %d", id)
+		}
+		logging.FromContext(ctx).Error("Error executing delete query", slog.Any("error", err))
 		return errors.Wrap(err, "execute query")
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		slog.Error("Error getting rows affected", slog.Any("error", err))
-		return errors.Wrap(err, "rows affected")
+	if err := insertEvent(ctx, tx, event); err != nil {
+		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no song found with ID %d", id)
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "commit transaction")
 	}
-	slog.Info("Song deleted successfully", slog.Int("id", id))
+	logging.FromContext(ctx).Info("Song deleted successfully", slog.Int("id", id))
 	return nil
 }
 
+// UpdateSongByID applies a manual edit. The edited fields are recorded as
+// manually set so later refreshes from the providers keep them.
 func (r *SongRepository) UpdateSongByID(ctx context.Context, id int, updateRequest *models.UpdateSongRequest) error {
-	slog.Debug("Updating song by ID", slog.Int("id", id), slog.Any("updateRequest", updateRequest))
+	ctx, span := tracing.Start(ctx, "SongRepository.UpdateSongByID")
+	defer span.End()
+
+	logging.FromContext(ctx).Debug("Updating song by ID", slog.Int("id", id), slog.Any("updateRequest", updateRequest))
 
 	query := "UPDATE songs SET "
 	var params []interface{}
 	var setClauses []string
+	sources := make(map[string]models.FieldOrigin)
+	manual := models.FieldOrigin{Origin: models.OriginManual}
 	paramCount := 1
 	if updateRequest.Group != nil {
 		setClauses = append(setClauses, fmt.Sprintf("group_name = $%d", paramCount))
 		params = append(params, *updateRequest.Group)
+		sources[models.FieldGroup] = manual
 		paramCount++
 	}
 	if updateRequest.Song != nil {
 		setClauses = append(setClauses, fmt.Sprintf("song = $%d", paramCount))
 		params = append(params, *updateRequest.Song)
+		sources[models.FieldSong] = manual
 		paramCount++
 	}
 	if updateRequest.Text != nil {
 		setClauses = append(setClauses, fmt.Sprintf("lyrics = $%d", paramCount))
 		params = append(params, *updateRequest.Text)
+		sources[models.FieldText] = manual
 		paramCount++
 	}
 	if updateRequest.ReleaseDate != nil {
-		setClauses = append(setClauses, fmt.Sprintf("release_date = $%d", paramCount))
-		params = append(params, *updateRequest.ReleaseDate)
-		paramCount++
+		releaseDate, err := parseReleaseDate(*updateRequest.ReleaseDate)
+		if err != nil {
+			return err
+		}
+		setClauses = append(setClauses, fmt.Sprintf("release_date = $%d, release_date_precision = $%d", paramCount, paramCount+1))
+		params = append(params, releaseDate.date, releaseDate.precision)
+		sources[models.FieldReleaseDate] = manual
+		paramCount += 2
 	}
 	if updateRequest.Link != nil {
 		setClauses = append(setClauses, fmt.Sprintf("link = $%d", paramCount))
 		params = append(params, *updateRequest.Link)
+		sources[models.FieldLink] = manual
 		paramCount++
 	}
 
 	if len(setClauses) == 0 {
-		slog.Warn("No fields provided for update", slog.Int("id", id))
-		return errors.New("no fields provided for update")
+		logging.FromContext(ctx).Warn("No fields provided for update", slog.Int("id", id))
+		return apperrors.Validation("empty_update", "no fields provided for update")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
 	}
+	defer tx.Rollback()
 
-	query += strings.Join(setClauses, ", ") + fmt.Sprintf(" WHERE song_id = $%d", paramCount)
+	if updateRequest.Group != nil {
+		groupID, err := getOrCreateGroup(ctx, tx, *updateRequest.Group)
+		if err != nil {
+			logging.FromContext(ctx).Error("Error getting or creating group", slog.Any("error", err))
+			return err
+		}
+		setClauses = append(setClauses, fmt.Sprintf("group_id = $%d", paramCount))
+		params = append(params, groupID)
+		paramCount++
+	}
+
+	query += strings.Join(setClauses, ", ") + fmt.Sprintf(" WHERE song_id = $%d RETURNING group_id, group_name", paramCount)
 	params = append(params, id)
 
-	result, err := r.db.ExecContext(ctx, query, params...)
+	event := models.Event{Type: models.EventSongUpdated, SongID: id}
+	err = tx.QueryRowContext(ctx, query, params...).Scan(&event.GroupID, &event.Group)
 	if err != nil {
-		slog.Error("Error executing update query", slog.Any("error", err))
+		if err == sql.ErrNoRows {
+			logging.FromContext(ctx).Info("No song found to update", slog.Int("id", id))
+			return apperrors.NotFound("song_not_found", "no song found with ID %d", id)
+		}
+		if isUniqueViolation(err) {
+			return apperrors.Conflict("song_already_exists", "a song with this title already exists").Wrap(err)
+		}
+		if isInvalidDate(err) {
+			return apperrors.Validation("invalid_release_date", "invalid release date").Wrap(err)
+		}
+		logging.FromContext(ctx).Error("Error executing update query", slog.Any("error", err))
 		return errors.Wrap(err, "execute query")
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		slog.Error("Error getting rows affected", slog.Any("error", err))
-		return errors.Wrap(err, "rows affected")
+	if err := saveFieldSources(ctx, tx, id, sources); err != nil {
+		logging.FromContext(ctx).Error("Error saving field sources", slog.Any("error", err))
+		return err
+	}
+
+	for field := range sources {
+		event.Fields = append(event.Fields, field)
 	}
-	if rowsAffected == 0 {
-		slog.Info("No song found to update", slog.Int("id", id))
-		return fmt.Errorf("no song found with ID %d", id)
+	slices.Sort(event.Fields)
+	if err := insertEvent(ctx, tx, event); err != nil {
+		return err
 	}
 
-	slog.Info("Song updated successfully", slog.Int("id", id))
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "commit transaction")
+	}
+
+	logging.FromContext(ctx).Info("Song updated successfully", slog.Int("id", id))
 	return nil
 }
 
 func (r *SongRepository) GetOrCreateGroup(ctx context.Context, groupName string) (int, error) {
+	ctx, span := tracing.Start(ctx, "SongRepository.GetOrCreateGroup")
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	groupID, err := getOrCreateGroup(ctx, tx, groupName)
+	if err != nil {
+		return 0, err
+	}
+	return groupID, errors.Wrap(tx.Commit(), "commit transaction")
+}
+
+func getOrCreateGroup(ctx context.Context, q querier, groupName string) (int, error) {
 	var groupID int
 
 	// Проверить, существует ли группа
 	queryCheck := "SELECT group_id FROM groups WHERE name = $1"
-	err := r.db.QueryRowContext(ctx, queryCheck, groupName).Scan(&groupID)
+	err := q.QueryRowContext(ctx, queryCheck, groupName).Scan(&groupID)
 	if err == nil {
 		return groupID, nil // Группа найдена, вернуть её ID
 	}
@@ -201,52 +312,399 @@ func (r *SongRepository) GetOrCreateGroup(ctx context.Context, groupName string)
 
 	// Если группы нет, добавить её
 	queryInsert := "INSERT INTO groups (name) VALUES ($1) RETURNING group_id"
-	err = r.db.QueryRowContext(ctx, queryInsert, groupName).Scan(&groupID)
+	err = q.QueryRowContext(ctx, queryInsert, groupName).Scan(&groupID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert group: %w", err)
 	}
 
+	if err := insertEvent(ctx, q, models.Event{Type: models.EventGroupCreated, GroupID: groupID, Group: groupName}); err != nil {
+		return 0, err
+	}
+
 	return groupID, nil
 }
 
 func (r *SongRepository) AddSong(ctx context.Context, group, song string, songDetail *models.SongDetail) (int, error) {
-	slog.Debug("Adding new song", slog.String("group", group), slog.String("song", song))
+	ctx, span := tracing.Start(ctx, "SongRepository.AddSong")
+	defer span.End()
 
-	formattedDate, err := convertDate(songDetail.ReleaseDate)
+	logging.FromContext(ctx).Debug("Adding new song", slog.String("group", group), slog.String("song", song))
+
+	releaseDate, err := parseReleaseDate(songDetail.ReleaseDate)
 	if err != nil {
-		slog.Error("Error converting date", slog.Any("error", err))
+		logging.FromContext(ctx).Error("Error converting date", slog.Any("error", err))
 		return 0, err
 	}
 
-	groupID, err := r.GetOrCreateGroup(ctx, group)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	groupID, err := getOrCreateGroup(ctx, tx, group)
 	if err != nil {
-		slog.Error("Error getting or creating group", slog.Any("error", err))
+		logging.FromContext(ctx).Error("Error getting or creating group", slog.Any("error", err))
 		return 0, err
 	}
 
-	slog.Debug("Group ID obtained", slog.Int("groupID", groupID))
+	logging.FromContext(ctx).Debug("Group ID obtained", slog.Int("groupID", groupID))
 
 	// Вставить песню
-	query := "INSERT INTO songs (group_name, song, lyrics, release_date, link,group_id) VALUES ($1, $2, $3, $4, $5,$6) RETURNING song_id"
+	query := "INSERT INTO songs (group_name, song, lyrics, release_date, release_date_precision, link,group_id) VALUES ($1, $2, $3, $4, $5, $6,$7) RETURNING song_id"
 	var songID int
-	err = r.db.QueryRowContext(ctx, query, group, song, songDetail.Text, formattedDate, songDetail.Link, groupID).Scan(&songID)
+	err = tx.QueryRowContext(ctx, query, group, song, songDetail.Text, releaseDate.date, releaseDate.precision, nullString(songDetail.Link), groupID).Scan(&songID)
 	if err != nil {
-		slog.Error("Error inserting new song", slog.Any("error", err))
+		if isUniqueViolation(err) {
+			return 0, apperrors.Conflict("song_already_exists", "song %q already exists", song).Wrap(err)
+		}
+		logging.FromContext(ctx).Error("Error inserting new song", slog.Any("error", err))
+		return 0, err
+	}
+
+	if err := saveFieldSources(ctx, tx, songID, songDetail.Sources); err != nil {
+		logging.FromContext(ctx).Error("Error saving field sources", slog.Any("error", err))
+		return 0, err
+	}
+
+	if err := insertEvent(ctx, tx, models.Event{Type: models.EventSongCreated, SongID: songID, GroupID: groupID, Group: group}); err != nil {
 		return 0, err
 	}
 
-	slog.Info("Song added successfully", slog.Int("songID", songID))
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "commit transaction")
+	}
+
+	logging.FromContext(ctx).Info("Song added successfully", slog.Int("songID", songID))
 	return songID, nil
 }
 
-func convertDate(dateStr string) (string, error) {
-	slog.Debug("Converting date", slog.String("dateStr", dateStr))
+// AddPendingSong stores a song whose details are not known yet together with
+// the job that will fetch them. It returns the song and job IDs.
+func (r *SongRepository) AddPendingSong(ctx context.Context, group, song string, maxAttempts int) (int, int, error) {
+	ctx, span := tracing.Start(ctx, "SongRepository.AddPendingSong")
+	defer span.End()
+
+	logging.FromContext(ctx).Debug("Adding pending song", slog.String("group", group), slog.String("song", song))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	groupID, err := getOrCreateGroup(ctx, tx, group)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error getting or creating group", slog.Any("error", err))
+		return 0, 0, err
+	}
+
+	query := "INSERT INTO songs (group_name, song, lyrics, group_id, status) VALUES ($1, $2, '', $3, $4) RETURNING song_id"
+	var songID int
+	err = tx.QueryRowContext(ctx, query, group, song, groupID, models.SongStatusPending).Scan(&songID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, 0, apperrors.Conflict("song_already_exists", "song %q already exists", song).Wrap(err)
+		}
+		logging.FromContext(ctx).Error("Error inserting pending song", slog.Any("error", err))
+		return 0, 0, err
+	}
+
+	jobQuery := "INSERT INTO enrichment_jobs (song_id, status, max_attempts) VALUES ($1, $2, $3) RETURNING job_id"
+	var jobID int
+	if err := tx.QueryRowContext(ctx, jobQuery, songID, models.JobStatusQueued, maxAttempts).Scan(&jobID); err != nil {
+		logging.FromContext(ctx).Error("Error inserting enrichment job", slog.Any("error", err))
+		return 0, 0, errors.Wrap(err, "insert enrichment job")
+	}
+
+	if err := insertEvent(ctx, tx, models.Event{Type: models.EventSongCreated, SongID: songID, GroupID: groupID, Group: group}); err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, errors.Wrap(err, "commit transaction")
+	}
+
+	logging.FromContext(ctx).Info("Pending song added", slog.Int("songID", songID), slog.Int("jobID", jobID))
+	return songID, jobID, nil
+}
+
+// GetIncompleteSongs returns ready songs that miss lyrics, release date or
+// link, in ID order starting after afterID.
+func (r *SongRepository) GetIncompleteSongs(ctx context.Context, afterID, limit int) ([]models.Song, error) {
+	ctx, span := tracing.Start(ctx, "SongRepository.GetIncompleteSongs")
+	defer span.End()
+
+	query := `
+		SELECT song_id, group_name, song, lyrics, release_date, release_date_precision, link, status
+		FROM songs
+		WHERE status = $1
+			AND (lyrics = '' OR release_date IS NULL OR link IS NULL OR link = '')
+			AND song_id > $2
+		ORDER BY song_id
+		LIMIT $3
+	`
+	rows, err := r.db.QueryContext(ctx, query, models.SongStatusReady, afterID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "query incomplete songs")
+	}
+	defer rows.Close()
+
+	var songs []models.Song
+	for rows.Next() {
+		song, err := scanSong(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan song")
+		}
+		songs = append(songs, song)
+	}
+	return songs, rows.Err()
+}
+
+// ApplySongDetails writes fetched details to a stored song and returns the
+// names of the fields it changed. Manually set fields are kept unless
+// opts.Force is set, empty values never replace stored ones.
+func (r *SongRepository) ApplySongDetails(ctx context.Context, id int, songDetail *models.SongDetail, opts models.ApplyOptions) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "SongRepository.ApplySongDetails")
+	defer span.End()
+
+	releaseDate, err := parseReleaseDate(songDetail.ReleaseDate)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	var (
+		lyrics      string
+		currentDate sql.NullTime
+		link        sql.NullString
+		event       = models.Event{Type: models.EventSongUpdated, SongID: id}
+	)
+	query := "SELECT lyrics, release_date, link, group_id, group_name FROM songs WHERE song_id = $1 FOR UPDATE"
+	if err := tx.QueryRowContext(ctx, query, id).Scan(&lyrics, &currentDate, &link, &event.GroupID, &event.Group); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("song_not_found", "no song found with ID %d", id)
+		}
+		return nil, errors.Wrap(err, "lock song")
+	}
+
+	origins, err := fieldOrigins(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	offered := map[string]bool{
+		models.FieldText:        songDetail.Text != "",
+		models.FieldReleaseDate: releaseDate.date.Valid,
+		models.FieldLink:        songDetail.Link != "",
+	}
+	stored := map[string]bool{
+		models.FieldText:        lyrics != "",
+		models.FieldReleaseDate: currentDate.Valid,
+		models.FieldLink:        link.Valid && link.String != "",
+	}
+	filled := fieldsToWrite(offered, stored, origins, opts)
+
+	var (
+		setClauses []string
+		params     []interface{}
+		sources    = make(map[string]models.FieldOrigin)
+	)
+	set := func(column string, value interface{}) {
+		params = append(params, value)
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", column, len(params)))
+	}
+	for _, field := range filled {
+		switch field {
+		case models.FieldText:
+			set("lyrics", songDetail.Text)
+		case models.FieldReleaseDate:
+			set("release_date", releaseDate.date)
+			set("release_date_precision", releaseDate.precision)
+		case models.FieldLink:
+			set("link", songDetail.Link)
+		}
+		if origin, ok := songDetail.Sources[field]; ok {
+			sources[field] = origin
+		}
+	}
+	event.Fields = filled
+	if opts.MarkReady {
+		params = append(params, models.SongStatusReady)
+		setClauses = append(setClauses, fmt.Sprintf("status = $%d", len(params)))
+		event.Fields = append(slices.Clone(filled), models.FieldStatus)
+	}
+
+	if len(setClauses) == 0 {
+		return nil, nil
+	}
+
+	params = append(params, id)
+	update := "UPDATE songs SET " + strings.Join(setClauses, ", ") + fmt.Sprintf(" WHERE song_id = $%d", len(params))
+	if _, err := tx.ExecContext(ctx, update, params...); err != nil {
+		return nil, errors.Wrap(err, "update song")
+	}
+
+	if err := saveFieldSources(ctx, tx, id, sources); err != nil {
+		return nil, err
+	}
+
+	if err := insertEvent(ctx, tx, event); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "commit transaction")
+	}
+
+	logging.FromContext(ctx).Info("Song details applied", slog.Int("id", id), slog.Any("fields", filled))
+	return filled, nil
+}
+
+// fieldsToWrite picks the offered fields that may replace the stored values:
+// manual values are kept unless opts.Force is set, and with opts.OnlyEmpty
+// only fields without a stored value are filled.
+func fieldsToWrite(offered, stored map[string]bool, origins map[string]string, opts models.ApplyOptions) []string {
+	var fields []string
+	for _, field := range []string{models.FieldText, models.FieldReleaseDate, models.FieldLink} {
+		switch {
+		case !offered[field]:
+		case origins[field] == models.OriginManual && !opts.Force:
+		case opts.OnlyEmpty && stored[field]:
+		default:
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// GetFieldProvenance returns where each recorded field of the song came from.
+func (r *SongRepository) GetFieldProvenance(ctx context.Context, id int) ([]models.FieldProvenance, error) {
+	ctx, span := tracing.Start(ctx, "SongRepository.GetFieldProvenance")
+	defer span.End()
 
-	parsedDate, err := time.Parse("02.01.2006", dateStr)
+	query := "SELECT field, origin, provider, updated_at FROM song_field_sources WHERE song_id = $1 ORDER BY field"
+	rows, err := r.db.QueryContext(ctx, query, id)
 	if err != nil {
-		slog.Error("Error parsing date", slog.Any("error", err))
-		return "", fmt.Errorf("failed to parse date: %w", err)
+		return nil, errors.Wrap(err, "query field provenance")
 	}
+	defer rows.Close()
+
+	provenance := []models.FieldProvenance{}
+	for rows.Next() {
+		var p models.FieldProvenance
+		if err := rows.Scan(&p.Field, &p.Origin, &p.Provider, &p.UpdatedAt); err != nil {
+			return nil, errors.Wrap(err, "scan field provenance")
+		}
+		provenance = append(provenance, p)
+	}
+	return provenance, rows.Err()
+}
+
+func fieldOrigins(ctx context.Context, q querier, songID int) (map[string]string, error) {
+	rows, err := q.QueryContext(ctx, "SELECT field, origin FROM song_field_sources WHERE song_id = $1", songID)
+	if err != nil {
+		return nil, errors.Wrap(err, "query field origins")
+	}
+	defer rows.Close()
+
+	origins := make(map[string]string)
+	for rows.Next() {
+		var field, origin string
+		if err := rows.Scan(&field, &origin); err != nil {
+			return nil, errors.Wrap(err, "scan field origin")
+		}
+		origins[field] = origin
+	}
+	return origins, rows.Err()
+}
+
+func saveFieldSources(ctx context.Context, q querier, songID int, sources map[string]models.FieldOrigin) error {
+	query := `
+		INSERT INTO song_field_sources (song_id, field, origin, provider, updated_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (song_id, field) DO UPDATE
+		SET origin = EXCLUDED.origin, provider = EXCLUDED.provider, updated_at = EXCLUDED.updated_at
+	`
+	for field, origin := range sources {
+		if _, err := q.ExecContext(ctx, query, songID, field, origin.Origin, nullString(origin.Provider)); err != nil {
+			return errors.Wrap(err, "save field source")
+		}
+	}
+	return nil
+}
+
+// releaseDateColumns holds the release_date and release_date_precision columns.
+type releaseDateColumns struct {
+	date      sql.NullTime
+	precision sql.NullString
+}
 
-	return parsedDate.Format("2006-01-02"), nil
+// parseReleaseDate converts a release date for storage, an empty date is
+// stored as NULL.
+func parseReleaseDate(dateStr string) (releaseDateColumns, error) {
+	if strings.TrimSpace(dateStr) == "" {
+		return releaseDateColumns{}, nil
+	}
+
+	date, err := releasedate.Parse(dateStr)
+	if err != nil {
+		slog.Debug("Error parsing date", slog.String("dateStr", dateStr), slog.Any("error", err))
+		return releaseDateColumns{}, apperrors.Validation("invalid_release_date", "release date %q: %v", dateStr, err).Wrap(err)
+	}
+
+	return releaseDateColumns{
+		date:      sql.NullTime{Time: date.Time, Valid: true},
+		precision: sql.NullString{String: string(date.Precision), Valid: true},
+	}, nil
+}
+
+// scanSong reads the columns song_id, group_name, song, lyrics, release_date,
+// release_date_precision, link and status. The release date is rendered at
+// its precision.
+func scanSong(row scanner) (models.Song, error) {
+	var (
+		song      models.Song
+		date      sql.NullTime
+		precision sql.NullString
+	)
+	if err := row.Scan(&song.ID, &song.Group, &song.Song, &song.Text, &date, &precision, &song.Link, &song.Status); err != nil {
+		return models.Song{}, err
+	}
+
+	if date.Valid {
+		rendered := releasedate.New(date.Time, releasedate.Precision(precision.String)).String()
+		song.ReleaseDate = &rendered
+	}
+	return song, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func isUniqueViolation(err error) bool {
+	return hasPQCode(err, uniqueViolation)
+}
+
+func isInvalidDate(err error) bool {
+	return hasPQCode(err, invalidDatetimeFormat, datetimeFieldOverflow)
+}
+
+func hasPQCode(err error, codes ...pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	for _, code := range codes {
+		if pqErr.Code == code {
+			return true
+		}
+	}
+	return false
 }
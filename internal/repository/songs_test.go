@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+func TestFieldsToWrite(t *testing.T) {
+	all := map[string]bool{models.FieldText: true, models.FieldReleaseDate: true, models.FieldLink: true}
+	none := map[string]bool{}
+	manualText := map[string]string{models.FieldText: models.OriginManual, models.FieldLink: models.OriginProvider}
+
+	tests := []struct {
+		name    string
+		offered map[string]bool
+		stored  map[string]bool
+		origins map[string]string
+		opts    models.ApplyOptions
+		want    []string
+	}{
+		{"resync fills an empty song", all, none, nil, models.ApplyOptions{OnlyEmpty: true}, []string{models.FieldText, models.FieldReleaseDate, models.FieldLink}},
+		{"resync keeps stored values", all, map[string]bool{models.FieldText: true, models.FieldLink: true}, nil, models.ApplyOptions{OnlyEmpty: true}, []string{models.FieldReleaseDate}},
+		{"resync keeps a complete song", all, all, nil, models.ApplyOptions{OnlyEmpty: true}, nil},
+		{"resync skips fields not offered", map[string]bool{models.FieldLink: true}, none, nil, models.ApplyOptions{OnlyEmpty: true}, []string{models.FieldLink}},
+		{"refresh replaces provider values", all, all, manualText, models.ApplyOptions{}, []string{models.FieldReleaseDate, models.FieldLink}},
+		{"refresh keeps manual values", map[string]bool{models.FieldText: true}, none, manualText, models.ApplyOptions{}, nil},
+		{"force replaces manual values", all, all, manualText, models.ApplyOptions{Force: true}, []string{models.FieldText, models.FieldReleaseDate, models.FieldLink}},
+		{"nothing offered", none, none, nil, models.ApplyOptions{Force: true}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fieldsToWrite(tt.offered, tt.stored, tt.origins, tt.opts); !slices.Equal(got, tt.want) {
+				t.Errorf("fieldsToWrite = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
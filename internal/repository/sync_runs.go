@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log/slog"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/pkg/errors"
+)
+
+// syncLockKey is the advisory lock held for the whole of a sync run, so that
+// several instances never run at the same time.
+const syncLockKey = 0x53796e6352756e // "SyncRun"
+
+type SyncRunRepository struct {
+	db instrumentedDB
+}
+
+func NewSyncRunRepository(db *sql.DB) *SyncRunRepository {
+	return &SyncRunRepository{db: instrument(db)}
+}
+
+// LockRuns takes the sync lock. A session lock lives as long as its
+// connection, so it takes one from the pool for itself; unlock releases the
+// lock and returns the connection. ok is false if another instance holds the
+// lock.
+func (r *SyncRunRepository) LockRuns(ctx context.Context) (unlock func(), ok bool, err error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "get connection")
+	}
+
+	query := "SELECT pg_try_advisory_lock($1)"
+	lockCtx, done := statement(ctx, query)
+	err = conn.QueryRowContext(lockCtx, query, syncLockKey).Scan(&ok)
+	done(err)
+	if err != nil || !ok {
+		conn.Close()
+		return nil, false, errors.Wrap(err, "lock sync runs")
+	}
+
+	unlock = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", syncLockKey); err != nil {
+			slog.Error("Failed to release the sync lock", slog.Any("error", err))
+			// A connection still holding the lock must not go back to the pool.
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+	return unlock, true, nil
+}
+
+func (r *SyncRunRepository) CreateRun(ctx context.Context) (*models.SyncRun, error) {
+	query := `INSERT INTO sync_runs (status) VALUES ($1) RETURNING run_id, status, started_at`
+
+	run := &models.SyncRun{}
+	if err := r.db.QueryRowContext(ctx, query, models.SyncStatusRunning).Scan(&run.ID, &run.Status, &run.StartedAt); err != nil {
+		return nil, errors.Wrap(err, "create sync run")
+	}
+	return run, nil
+}
+
+func (r *SyncRunRepository) FinishRun(ctx context.Context, run *models.SyncRun) error {
+	query := `
+		UPDATE sync_runs
+		SET status = $1, songs_checked = $2, songs_updated = $3, songs_skipped = $4, songs_failed = $5, last_error = $6, finished_at = now()
+		WHERE run_id = $7
+	`
+	_, err := r.db.ExecContext(ctx, query, run.Status, run.Checked, run.Updated, run.Skipped, run.Failed, run.LastError, run.ID)
+	return errors.Wrap(err, "finish sync run")
+}
+
+// ListRuns returns the latest runs, newest first.
+func (r *SyncRunRepository) ListRuns(ctx context.Context, limit int) ([]models.SyncRun, error) {
+	query := `
+		SELECT run_id, status, songs_checked, songs_updated, songs_skipped, songs_failed, last_error, started_at, finished_at
+		FROM sync_runs
+		ORDER BY run_id DESC
+		LIMIT $1
+	`
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "list sync runs")
+	}
+	defer rows.Close()
+
+	runs := []models.SyncRun{}
+	for rows.Next() {
+		var run models.SyncRun
+		if err := rows.Scan(&run.ID, &run.Status, &run.Checked, &run.Updated, &run.Skipped, &run.Failed, &run.LastError, &run.StartedAt, &run.FinishedAt); err != nil {
+			return nil, errors.Wrap(err, "scan sync run")
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
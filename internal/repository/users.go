@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/pkg/errors"
+)
+
+type UserRepository struct {
+	db instrumentedDB
+}
+
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: instrument(db)}
+}
+
+const userColumns = `user_id, email, role, created_at`
+
+func scanUser(row scanner) (*models.User, error) {
+	var user models.User
+	if err := row.Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *UserRepository) CreateUser(ctx context.Context, user *models.User, passwordHash string) error {
+	query := `INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING user_id, role, created_at`
+	err := r.db.QueryRowContext(ctx, query, user.Email, passwordHash).Scan(&user.ID, &user.Role, &user.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return apperrors.Conflict("email_taken", "a user with email %s already exists", user.Email)
+		}
+		return errors.Wrap(err, "create user")
+	}
+	return nil
+}
+
+// GetUserByEmail returns the user and its password hash. Emails are compared
+// case-insensitively.
+func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, string, error) {
+	var (
+		user         models.User
+		passwordHash string
+	)
+	query := `SELECT ` + userColumns + `, password_hash FROM users WHERE lower(email) = lower($1)`
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt, &passwordHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", apperrors.NotFound("user_not_found", "no user found with email %s", email)
+		}
+		return nil, "", errors.Wrap(err, "fetch user")
+	}
+	return &user, passwordHash, nil
+}
+
+func (r *UserRepository) ListUsers(ctx context.Context) ([]models.User, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users ORDER BY user_id`)
+	if err != nil {
+		return nil, errors.Wrap(err, "list users")
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan user")
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// SetUserRole changes the role of a user and returns the updated user.
+func (r *UserRepository) SetUserRole(ctx context.Context, id int, role string) (*models.User, error) {
+	query := `UPDATE users SET role = $1 WHERE user_id = $2 RETURNING ` + userColumns
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, role, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("user_not_found", "no user found with ID %d", id)
+		}
+		return nil, errors.Wrap(err, "set user role")
+	}
+	return user, nil
+}
+
+// CreateSession stores a new login session together with its first refresh token.
+func (r *UserRepository) CreateSession(ctx context.Context, session *models.Session, tokenID string, expiresAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO user_sessions (session_id, user_id) VALUES ($1, $2)`, session.ID, session.UserID); err != nil {
+		return errors.Wrap(err, "create session")
+	}
+	query := `INSERT INTO refresh_tokens (token_id, session_id, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, query, tokenID, session.ID, expiresAt); err != nil {
+		return errors.Wrap(err, "create refresh token")
+	}
+
+	return errors.Wrap(tx.Commit(), "commit transaction")
+}
+
+func (r *UserRepository) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	var session models.Session
+	query := `
+		SELECT s.session_id, s.user_id, u.role, s.revoked_at
+		FROM user_sessions s
+		JOIN users u ON u.user_id = s.user_id
+		WHERE s.session_id = $1`
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&session.ID, &session.UserID, &session.Role, &session.RevokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("session_not_found", "no session found with ID %s", id)
+		}
+		return nil, errors.Wrap(err, "fetch session")
+	}
+	return &session, nil
+}
+
+// RotateRefreshToken uses up a refresh token and stores newTokenID in the same
+// session. Unknown and expired tokens and tokens of revoked sessions are not
+// found. A token that was already used has leaked: its session is revoked and
+// a conflict returned.
+func (r *UserRepository) RotateRefreshToken(ctx context.Context, tokenID, newTokenID string, expiresAt time.Time) (*models.Session, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	var (
+		session models.Session
+		usedAt  *time.Time
+	)
+	query := `
+		SELECT s.session_id, s.user_id, r.used_at
+		FROM refresh_tokens r
+		JOIN user_sessions s ON s.session_id = r.session_id
+		WHERE r.token_id = $1 AND r.expires_at > now() AND s.revoked_at IS NULL
+		FOR UPDATE OF r, s`
+	err = tx.QueryRowContext(ctx, query, tokenID).Scan(&session.ID, &session.UserID, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("refresh_token_not_found", "refresh token is unknown, expired or revoked")
+		}
+		return nil, errors.Wrap(err, "fetch refresh token")
+	}
+
+	if usedAt != nil {
+		if _, err := tx.ExecContext(ctx, `UPDATE user_sessions SET revoked_at = now() WHERE session_id = $1`, session.ID); err != nil {
+			return nil, errors.Wrap(err, "revoke session")
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, errors.Wrap(err, "commit transaction")
+		}
+		return nil, apperrors.Conflict("refresh_token_reused", "refresh token was already used, session %s revoked", session.ID)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = now() WHERE token_id = $1`, tokenID); err != nil {
+		return nil, errors.Wrap(err, "use refresh token")
+	}
+	insertQuery := `INSERT INTO refresh_tokens (token_id, session_id, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, insertQuery, newTokenID, session.ID, expiresAt); err != nil {
+		return nil, errors.Wrap(err, "create refresh token")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "commit transaction")
+	}
+	return &session, nil
+}
+
+// RevokeSession logs the session out. Revoking it again changes nothing.
+func (r *UserRepository) RevokeSession(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE user_sessions SET revoked_at = now() WHERE session_id = $1 AND revoked_at IS NULL`, id)
+	return errors.Wrap(err, "revoke session")
+}
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+type WebhookRepository struct {
+	db instrumentedDB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: instrument(db)}
+}
+
+const deliveryColumns = `delivery_id, subscription_id, event_id, event_type, status, attempts, max_attempts, response_status, last_error, next_attempt_at, delivered_at, created_at, updated_at`
+
+func scanDelivery(row scanner, extra ...interface{}) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	dest := []interface{}{&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.MaxAttempts,
+		&d.ResponseStatus, &d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt, &d.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	query := `INSERT INTO webhook_subscriptions (url, secret, event_types) VALUES ($1, $2, $3) RETURNING subscription_id, active, created_at`
+	err := r.db.QueryRowContext(ctx, query, sub.URL, sub.Secret, pq.Array(sub.EventTypes)).Scan(&sub.ID, &sub.Active, &sub.CreatedAt)
+	return errors.Wrap(err, "create webhook subscription")
+}
+
+// ListSubscriptions returns all subscriptions without their secrets.
+func (r *WebhookRepository) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	query := `SELECT subscription_id, url, event_types, active, created_at FROM webhook_subscriptions ORDER BY subscription_id`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "list webhook subscriptions")
+	}
+	defer rows.Close()
+
+	subs := []models.WebhookSubscription{}
+	for rows.Next() {
+		var sub models.WebhookSubscription
+		if err := rows.Scan(&sub.ID, &sub.URL, pq.Array(&sub.EventTypes), &sub.Active, &sub.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "scan webhook subscription")
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE subscription_id = $1`, id)
+	if err != nil {
+		return errors.Wrap(err, "delete webhook subscription")
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+	if rowsAffected == 0 {
+		return apperrors.NotFound("webhook_not_found", "no webhook subscription found with ID %d", id)
+	}
+	return nil
+}
+
+// EnqueueDeliveries creates a delivery of the event for every active
+// subscription that wants its type and returns how many were created.
+func (r *WebhookRepository) EnqueueDeliveries(ctx context.Context, event models.Event, payload []byte, maxAttempts int) (int, error) {
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, max_attempts)
+		SELECT subscription_id, $1, $2, $3, $4
+		FROM webhook_subscriptions
+		WHERE active AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+	`
+	result, err := r.db.ExecContext(ctx, query, event.ID, event.Type, payload, maxAttempts)
+	if err != nil {
+		return 0, errors.Wrap(err, "enqueue webhook deliveries")
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "rows affected")
+	}
+	return int(n), nil
+}
+
+// ClaimDelivery takes the next due delivery together with the URL and secret
+// of its subscription and leases it to owner for the given time. It returns
+// nil when there is nothing to do.
+func (r *WebhookRepository) ClaimDelivery(ctx context.Context, owner string, lease time.Duration) (*models.WebhookDelivery, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET status = $1, attempts = attempts + 1, locked_by = $4, locked_until = now() + $2::double precision * interval '1 millisecond', updated_at = now()
+			WHERE delivery_id = (
+				SELECT delivery_id FROM webhook_deliveries
+				WHERE (status = $3 AND next_attempt_at <= now())
+					OR (status = $1 AND locked_until < now())
+				ORDER BY next_attempt_at
+				FOR UPDATE SKIP LOCKED
+				LIMIT 1
+			)
+			RETURNING *
+		)
+		SELECT c.delivery_id, c.subscription_id, c.event_id, c.event_type, c.status, c.attempts, c.max_attempts,
+			c.response_status, c.last_error, c.next_attempt_at, c.delivered_at, c.created_at, c.updated_at,
+			s.url, s.secret, c.payload
+		FROM claimed c JOIN webhook_subscriptions s ON s.subscription_id = c.subscription_id
+	`
+
+	var url, secret string
+	var payload []byte
+	d, err := scanDelivery(r.db.QueryRowContext(ctx, query, models.DeliveryStatusRunning, lease.Milliseconds(), models.DeliveryStatusPending, owner), &url, &secret, &payload)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "claim webhook delivery")
+	}
+	d.URL, d.Secret, d.Payload = url, secret, payload
+	return d, nil
+}
+
+// CompleteDelivery, RetryDelivery and FailDelivery only change a delivery
+// whose lease owner still holds. Once it ran out, another worker may send it
+// again, and they return a conflict.
+func (r *WebhookRepository) CompleteDelivery(ctx context.Context, id int, owner string, responseStatus int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, response_status = $2, last_error = NULL, locked_by = NULL, locked_until = NULL, delivered_at = now(), updated_at = now()
+		WHERE delivery_id = $3 AND locked_by = $4 AND locked_until > now()
+	`
+	result, err := r.db.ExecContext(ctx, query, models.DeliveryStatusSucceeded, responseStatus, id, owner)
+	if err != nil {
+		return errors.Wrap(err, "complete webhook delivery")
+	}
+	return leaseLost(result, "webhook delivery", id)
+}
+
+// RetryDelivery puts the delivery back in the queue until nextAttempt.
+func (r *WebhookRepository) RetryDelivery(ctx context.Context, id int, owner string, nextAttempt time.Time, responseStatus *int, lastError string) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, response_status = $2, last_error = $3, next_attempt_at = $4, locked_by = NULL, locked_until = NULL, updated_at = now()
+		WHERE delivery_id = $5 AND locked_by = $6 AND locked_until > now()
+	`
+	result, err := r.db.ExecContext(ctx, query, models.DeliveryStatusPending, responseStatus, lastError, nextAttempt, id, owner)
+	if err != nil {
+		return errors.Wrap(err, "retry webhook delivery")
+	}
+	return leaseLost(result, "webhook delivery", id)
+}
+
+func (r *WebhookRepository) FailDelivery(ctx context.Context, id int, owner string, responseStatus *int, lastError string) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, response_status = $2, last_error = $3, locked_by = NULL, locked_until = NULL, updated_at = now()
+		WHERE delivery_id = $4 AND locked_by = $5 AND locked_until > now()
+	`
+	result, err := r.db.ExecContext(ctx, query, models.DeliveryStatusFailed, responseStatus, lastError, id, owner)
+	if err != nil {
+		return errors.Wrap(err, "fail webhook delivery")
+	}
+	return leaseLost(result, "webhook delivery", id)
+}
+
+// ListDeliveries returns the latest deliveries, newest first. A zero
+// subscriptionID lists the deliveries of all subscriptions.
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, subscriptionID, limit int) ([]models.WebhookDelivery, error) {
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE $1 = 0 OR subscription_id = $1
+		ORDER BY delivery_id DESC
+		LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, subscriptionID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "list webhook deliveries")
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan webhook delivery")
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// Redeliver queues a new delivery of the same event to the same subscription.
+func (r *WebhookRepository) Redeliver(ctx context.Context, id, maxAttempts int) (*models.WebhookDelivery, error) {
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, max_attempts)
+		SELECT subscription_id, event_id, event_type, payload, $2
+		FROM webhook_deliveries
+		WHERE delivery_id = $1
+		RETURNING ` + deliveryColumns
+
+	d, err := scanDelivery(r.db.QueryRowContext(ctx, query, id, maxAttempts))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFound("delivery_not_found", "no webhook delivery found with ID %d", id)
+		}
+		return nil, errors.Wrap(err, "redeliver webhook")
+	}
+	return d, nil
+}
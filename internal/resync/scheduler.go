@@ -0,0 +1,208 @@
+package resync
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+type (
+	SongSyncer interface {
+		GetIncompleteSongs(ctx context.Context, afterID, limit int) ([]models.Song, error)
+		ResyncSong(ctx context.Context, song models.Song) ([]string, error)
+	}
+
+	RunStorage interface {
+		// LockRuns keeps other instances from running until unlock is called,
+		// ok is false if one of them is running already.
+		LockRuns(ctx context.Context) (unlock func(), ok bool, err error)
+		CreateRun(ctx context.Context) (*models.SyncRun, error)
+		FinishRun(ctx context.Context, run *models.SyncRun) error
+		ListRuns(ctx context.Context, limit int) ([]models.SyncRun, error)
+	}
+
+	Config struct {
+		// Interval between runs, zero disables scheduled runs.
+		Interval time.Duration
+		// Rate is the number of provider lookups per second.
+		Rate      float64
+		BatchSize int
+	}
+
+	// Scheduler periodically refetches songs with missing details from the
+	// providers and fills in what is missing.
+	Scheduler struct {
+		songs   SongSyncer
+		runs    RunStorage
+		cfg     Config
+		trigger chan struct{}
+		wg      sync.WaitGroup
+	}
+)
+
+func NewScheduler(songs SongSyncer, runs RunStorage, cfg Config) *Scheduler {
+	if cfg.Rate <= 0 {
+		cfg.Rate = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+
+	return &Scheduler{
+		songs:   songs,
+		runs:    runs,
+		cfg:     cfg,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// Start runs the scheduler until ctx is cancelled, Wait blocks until it has stopped.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.loop(ctx)
+	}()
+}
+
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Trigger asks for a run as soon as possible. It reports false if a run is
+// already waiting to start.
+func (s *Scheduler) Trigger() bool {
+	select {
+	case s.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Scheduler) ListRuns(ctx context.Context, limit int) ([]models.SyncRun, error) {
+	return s.runs.ListRuns(ctx, limit)
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	var tick <-chan time.Time
+	if s.cfg.Interval > 0 {
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+		slog.Info("Song resync scheduled", slog.Duration("interval", s.cfg.Interval))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-s.trigger:
+		}
+		s.run(ctx)
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	unlock, ok, err := s.runs.LockRuns(ctx)
+	if err != nil {
+		slog.Error("Failed to lock sync runs", slog.Any("error", err))
+		return
+	}
+	if !ok {
+		slog.Info("Sync run skipped, another instance is running one")
+		return
+	}
+	defer unlock()
+
+	run, err := s.runs.CreateRun(ctx)
+	if err != nil {
+		slog.Error("Failed to start sync run", slog.Any("error", err))
+		return
+	}
+
+	logger := slog.With(slog.Int("run_id", run.ID))
+	logger.Info("Sync run started")
+	ctx = logging.WithLogger(ctx, logger)
+
+	limiter := time.NewTicker(time.Duration(float64(time.Second) / s.cfg.Rate))
+	defer limiter.Stop()
+
+	run.Status = s.syncAll(ctx, run, limiter.C, logger)
+
+	// Store the outcome even when the run was cut short by shutdown.
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := s.runs.FinishRun(storeCtx, run); err != nil {
+		logger.Error("Failed to store sync run", slog.Any("error", err))
+	}
+
+	logger.Info("Sync run finished", slog.String("status", run.Status), slog.Int("checked", run.Checked),
+		slog.Int("updated", run.Updated), slog.Int("skipped", run.Skipped), slog.Int("failed", run.Failed))
+}
+
+func (s *Scheduler) syncAll(ctx context.Context, run *models.SyncRun, limiter <-chan time.Time, logger *slog.Logger) string {
+	afterID := 0
+	for {
+		songs, err := s.songs.GetIncompleteSongs(ctx, afterID, s.cfg.BatchSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return models.SyncStatusCancelled
+			}
+			logger.Error("Failed to list incomplete songs", slog.Any("error", err))
+			setLastError(run, err)
+			return models.SyncStatusFailed
+		}
+		if len(songs) == 0 {
+			break
+		}
+
+		for _, song := range songs {
+			select {
+			case <-ctx.Done():
+				return models.SyncStatusCancelled
+			case <-limiter:
+			}
+
+			afterID = song.ID
+			run.Checked++
+
+			fields, err := s.songs.ResyncSong(ctx, song)
+			switch {
+			case errors.Is(err, apperrors.ErrNotFound):
+				run.Skipped++
+			case err != nil:
+				if ctx.Err() != nil {
+					return models.SyncStatusCancelled
+				}
+				logger.Warn("Failed to resync song", slog.Int("song_id", song.ID), slog.Any("error", err))
+				run.Failed++
+				setLastError(run, err)
+			case len(fields) == 0:
+				run.Skipped++
+			default:
+				run.Updated++
+			}
+		}
+	}
+
+	if run.Failed > 0 {
+		if run.Updated == 0 {
+			return models.SyncStatusFailed
+		}
+		return models.SyncStatusPartial
+	}
+	return models.SyncStatusSucceeded
+}
+
+func setLastError(run *models.SyncRun, err error) {
+	msg := err.Error()
+	run.LastError = &msg
+}
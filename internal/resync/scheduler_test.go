@@ -0,0 +1,92 @@
+package resync
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+// memorySyncer answers every song with the outcome stored for its ID.
+type memorySyncer struct {
+	songs    []models.Song
+	outcomes map[int]error
+	filled   map[int][]string
+}
+
+func (m *memorySyncer) GetIncompleteSongs(ctx context.Context, afterID, limit int) ([]models.Song, error) {
+	var songs []models.Song
+	for _, song := range m.songs {
+		if song.ID > afterID && len(songs) < limit {
+			songs = append(songs, song)
+		}
+	}
+	return songs, nil
+}
+
+func (m *memorySyncer) ResyncSong(ctx context.Context, song models.Song) ([]string, error) {
+	return m.filled[song.ID], m.outcomes[song.ID]
+}
+
+type memoryRuns struct {
+	RunStorage
+	locked   bool
+	unlocked bool
+	finished []models.SyncRun
+}
+
+func (m *memoryRuns) LockRuns(ctx context.Context) (func(), bool, error) {
+	if m.locked {
+		return nil, false, nil
+	}
+	return func() { m.unlocked = true }, true, nil
+}
+
+func (m *memoryRuns) CreateRun(ctx context.Context) (*models.SyncRun, error) {
+	return &models.SyncRun{ID: len(m.finished) + 1, Status: models.SyncStatusRunning}, nil
+}
+
+func (m *memoryRuns) FinishRun(ctx context.Context, run *models.SyncRun) error {
+	m.finished = append(m.finished, *run)
+	return nil
+}
+
+func TestSchedulerRun(t *testing.T) {
+	syncer := &memorySyncer{
+		songs: []models.Song{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}},
+		outcomes: map[int]error{
+			3: apperrors.NotFound("song_detail_not_found", "no details"),
+			5: errors.New("provider down"),
+		},
+		filled: map[int][]string{1: {models.FieldText}, 4: {models.FieldLink, models.FieldReleaseDate}},
+	}
+	runs := &memoryRuns{}
+
+	s := NewScheduler(syncer, runs, Config{Rate: 1000, BatchSize: 2})
+	s.run(context.Background())
+
+	if len(runs.finished) != 1 || !runs.unlocked {
+		t.Fatalf("finished runs = %d, unlocked = %v", len(runs.finished), runs.unlocked)
+	}
+	run := runs.finished[0]
+	if run.Status != models.SyncStatusPartial || run.Checked != 5 || run.Updated != 2 || run.Skipped != 2 || run.Failed != 1 {
+		t.Errorf("run = %+v", run)
+	}
+	if run.LastError == nil || *run.LastError != "provider down" {
+		t.Errorf("last error = %v", run.LastError)
+	}
+}
+
+func TestSchedulerSkipsLockedRun(t *testing.T) {
+	syncer := &memorySyncer{songs: []models.Song{{ID: 1}}}
+	runs := &memoryRuns{locked: true}
+
+	s := NewScheduler(syncer, runs, Config{Rate: 1000})
+	s.run(context.Background())
+
+	if len(runs.finished) != 0 {
+		t.Errorf("run started while another instance holds the lock: %+v", runs.finished)
+	}
+}
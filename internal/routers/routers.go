@@ -1,21 +1,126 @@
 package routers
 
 import (
+	"net/http"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/api"
+	"github.com/KarmaBeLike/SongLibrary/internal/auth"
+	"github.com/KarmaBeLike/SongLibrary/internal/enrichment"
+	"github.com/KarmaBeLike/SongLibrary/internal/feed"
 	"github.com/KarmaBeLike/SongLibrary/internal/handlers"
+	"github.com/KarmaBeLike/SongLibrary/internal/health"
+	"github.com/KarmaBeLike/SongLibrary/internal/metrics"
+	"github.com/KarmaBeLike/SongLibrary/internal/middleware"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/KarmaBeLike/SongLibrary/internal/ratelimit"
+	"github.com/KarmaBeLike/SongLibrary/internal/resync"
 	"github.com/KarmaBeLike/SongLibrary/internal/service"
+	"github.com/KarmaBeLike/SongLibrary/internal/webhook"
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
-func SetupRoutes(songService *service.SongService) *mux.Router {
-	songHandler := handlers.NewSongClient(songService)
+type Deps struct {
+	SongService *service.SongService
+	Breakers    []*api.CircuitBreaker
+	Caches      []*api.CachedFetcher
+	Enrichment  *enrichment.Pool
+	Resync      *resync.Scheduler
+	Webhooks    *webhook.Dispatcher
+	Events      *feed.Broker
+	APIKeys     *auth.Keys
+	Sessions    *auth.Sessions
+	Roles       *auth.Roles
+	Health      *health.Checker
+	// RateLimiter limits requests per client, nil disables it.
+	RateLimiter *ratelimit.Limiter
+	// ProxyHops is the number of proxies appending to X-Forwarded-For, the
+	// client IP is taken from it when above zero.
+	ProxyHops int
+	// AuthEnabled makes every route except the docs and the login routes
+	// require an API key or access token.
+	AuthEnabled bool
+}
+
+func SetupRoutes(deps Deps) *mux.Router {
+	songHandler := handlers.NewSongClient(deps.SongService)
+
+	breakers := make([]handlers.Breaker, 0, len(deps.Breakers))
+	for _, b := range deps.Breakers {
+		breakers = append(breakers, b)
+	}
+	caches := make([]handlers.Cache, 0, len(deps.Caches))
+	for _, c := range deps.Caches {
+		caches = append(caches, c)
+	}
+	adminHandler := handlers.NewAdminClient(breakers, caches)
+	jobHandler := handlers.NewJobClient(deps.Enrichment)
+	syncHandler := handlers.NewSyncClient(deps.Resync)
+	webhookHandler := handlers.NewWebhookClient(deps.Webhooks)
+	eventHandler := handlers.NewEventClient(deps.Events)
+	keyHandler := handlers.NewAPIKeyClient(deps.APIKeys)
+	userHandler := handlers.NewUserClient(deps.Sessions)
+	roleHandler := handlers.NewRoleClient(deps.Roles)
+	healthHandler := handlers.NewHealthClient(deps.Health)
 
 	router := mux.NewRouter()
-	router.HandleFunc("/api/songs", songHandler.GetSongs).Methods("GET")
-	router.HandleFunc("/api/songs/lyrics", songHandler.GetSongLyrics).Methods("GET")
-	router.HandleFunc("/api/songs", songHandler.DeleteSong).Methods("DELETE")
-	router.HandleFunc("/api/songs", songHandler.UpdateSong).Methods("PATCH")
-	router.HandleFunc("/api/songs", songHandler.AddSong).Methods("POST")
+	router.Use(middleware.RequestID, middleware.Tracing, middleware.AccessLog, middleware.Metrics)
+
+	// limit takes a token from each budget of the caller before calling the
+	// handler, unless rate limiting is off.
+	limit := func(h http.Handler, budgets ...string) http.Handler {
+		if deps.RateLimiter == nil {
+			return h
+		}
+		return middleware.RateLimit(deps.RateLimiter, deps.ProxyHops, handlers.WriteError, budgets...)(h)
+	}
+	// require wraps a rate limited handler with the permission check, or
+	// leaves it open when authentication is off.
+	require := func(permission string, h http.HandlerFunc, budgets ...string) http.Handler {
+		if !deps.AuthEnabled {
+			return limit(h, budgets...)
+		}
+		return middleware.RequirePermission(permission, handlers.WriteError)(limit(h, budgets...))
+	}
+	if deps.AuthEnabled {
+		router.Use(middleware.Authenticate(auth.NewAuthenticator(deps.APIKeys, deps.Sessions), handlers.WriteError))
+	}
+
+	router.Handle("/api/auth/register", limit(http.HandlerFunc(userHandler.Register), ratelimit.Write)).Methods("POST")
+	router.Handle("/api/auth/login", limit(http.HandlerFunc(userHandler.Login), ratelimit.Write)).Methods("POST")
+	router.Handle("/api/auth/refresh", limit(http.HandlerFunc(userHandler.Refresh), ratelimit.Write)).Methods("POST")
+	router.Handle("/api/auth/logout", limit(http.HandlerFunc(userHandler.Logout), ratelimit.Write)).Methods("POST")
+	router.Handle("/api/auth/me", require(models.PermReadSongs, userHandler.Me, ratelimit.Read)).Methods("GET")
+
+	router.Handle("/api/songs", require(models.PermReadSongs, songHandler.GetSongs, ratelimit.Read)).Methods("GET")
+	router.Handle("/api/songs/lyrics", require(models.PermReadSongs, songHandler.GetSongLyrics, ratelimit.Read)).Methods("GET")
+	router.Handle("/api/songs/detail", require(models.PermReadSongs, songHandler.GetSongDetail, ratelimit.Read)).Methods("GET")
+	router.Handle("/api/songs/refresh", require(models.PermUpdateSongs, songHandler.RefreshSong, ratelimit.Write)).Methods("POST")
+	router.Handle("/api/songs", require(models.PermDeleteSongs, songHandler.DeleteSong, ratelimit.Write)).Methods("DELETE")
+	router.Handle("/api/songs", require(models.PermUpdateSongs, songHandler.UpdateSong, ratelimit.Write)).Methods("PATCH")
+	router.Handle("/api/songs", require(models.PermCreateSongs, songHandler.AddSong, ratelimit.Write)).Methods("POST")
+	router.Handle("/api/jobs", require(models.PermReadSongs, jobHandler.GetJob, ratelimit.Read)).Methods("GET")
+	router.Handle("/api/events", require(models.PermReadSongs, eventHandler.StreamEvents, ratelimit.Read)).Methods("GET")
+
+	router.Handle("/api/admin/breakers", require(models.PermManageSystem, adminHandler.GetBreakers, ratelimit.Read)).Methods("GET")
+	router.Handle("/api/admin/caches", require(models.PermManageSystem, adminHandler.GetCaches, ratelimit.Read)).Methods("GET")
+	router.Handle("/api/admin/sync-runs", require(models.PermManageSystem, syncHandler.GetSyncRuns, ratelimit.Read)).Methods("GET")
+	router.Handle("/api/admin/sync-runs", require(models.PermManageSystem, syncHandler.StartSyncRun, ratelimit.Write, ratelimit.Upstream)).Methods("POST")
+	router.Handle("/api/admin/webhooks", require(models.PermManageSystem, webhookHandler.GetWebhooks, ratelimit.Read)).Methods("GET")
+	router.Handle("/api/admin/webhooks", require(models.PermManageSystem, webhookHandler.CreateWebhook, ratelimit.Write)).Methods("POST")
+	router.Handle("/api/admin/webhooks", require(models.PermManageSystem, webhookHandler.DeleteWebhook, ratelimit.Write)).Methods("DELETE")
+	router.Handle("/api/admin/webhooks/deliveries", require(models.PermManageSystem, webhookHandler.GetDeliveries, ratelimit.Read)).Methods("GET")
+	router.Handle("/api/admin/webhooks/deliveries/redeliver", require(models.PermManageSystem, webhookHandler.Redeliver, ratelimit.Write)).Methods("POST")
+	router.Handle("/api/admin/api-keys", require(models.PermManageSystem, keyHandler.GetAPIKeys, ratelimit.Read)).Methods("GET")
+	router.Handle("/api/admin/api-keys", require(models.PermManageSystem, keyHandler.CreateAPIKey, ratelimit.Write)).Methods("POST")
+	router.Handle("/api/admin/api-keys", require(models.PermManageSystem, keyHandler.RevokeAPIKey, ratelimit.Write)).Methods("DELETE")
+
+	router.Handle("/api/admin/users", require(models.PermManageUsers, roleHandler.GetUsers, ratelimit.Read)).Methods("GET")
+	router.Handle("/api/admin/users/role", require(models.PermManageUsers, roleHandler.SetUserRole, ratelimit.Write)).Methods("PUT")
+
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	router.HandleFunc("/healthz", healthHandler.Live).Methods("GET")
+	router.HandleFunc("/readyz", healthHandler.Ready).Methods("GET")
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
 	return router
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/KarmaBeLike/SongLibrary/internal/ratelimit"
+)
+
+// fetchSongDetail asks the providers in order and merges their answers field
+// by field: a field is taken from the first provider that has it. Later
+// providers are only asked while some field is still missing.
+func (s *SongService) fetchSongDetail(ctx context.Context, group, song string) (*models.SongDetail, error) {
+	// Only requests that reach the providers count against the upstream budget.
+	if err := ratelimit.Spend(ctx, ratelimit.Upstream); err != nil {
+		return nil, err
+	}
+
+	merged := &models.SongDetail{Sources: make(map[string]models.FieldOrigin)}
+	var errs []error
+
+	for _, provider := range s.providers {
+		detail, err := provider.Fetcher.FetchSongDetail(ctx, group, song)
+		if err != nil {
+			logging.FromContext(ctx).Warn("Provider failed to return song detail", slog.String("provider", provider.Name), slog.Any("error", err))
+			errs = append(errs, err)
+			continue
+		}
+
+		origin := models.FieldOrigin{Origin: models.OriginProvider, Provider: provider.Name}
+		mergeField(merged, models.FieldText, &merged.Text, detail.Text, origin)
+		mergeField(merged, models.FieldReleaseDate, &merged.ReleaseDate, detail.ReleaseDate, origin)
+		mergeField(merged, models.FieldLink, &merged.Link, detail.Link, origin)
+
+		if len(merged.Sources) == 3 {
+			break
+		}
+	}
+
+	if len(merged.Sources) == 0 {
+		return nil, providersError(errs)
+	}
+
+	logging.FromContext(ctx).Info("Song detail fetched", slog.String("group", group), slog.String("song", song), slog.Any("sources", merged.Sources))
+	return merged, nil
+}
+
+func mergeField(detail *models.SongDetail, field string, dst *string, value string, origin models.FieldOrigin) {
+	if *dst != "" || value == "" {
+		return
+	}
+	*dst = value
+	detail.Sources[field] = origin
+}
+
+// providersError picks the error to report when no provider had anything.
+// "Not found" is only reported if every provider said so.
+func providersError(errs []error) error {
+	if len(errs) == 0 {
+		return apperrors.NotFound("song_detail_not_found", "no provider has details for this song")
+	}
+
+	for _, err := range errs {
+		if !errors.Is(err, apperrors.ErrNotFound) {
+			return err
+		}
+	}
+	return errs[0]
+}
+
+// songSource validates the requested source of a new song's details and
+// picks the default one.
+func songSource(newSong models.NewSongRequest) (string, error) {
+	hasDetails := newSong.Text != nil || newSong.ReleaseDate != nil || newSong.Link != nil
+
+	switch newSong.Source {
+	case "":
+		if hasDetails {
+			return models.SourceMerge, nil
+		}
+		return models.SourceProvider, nil
+	case models.SourceProvider:
+		if hasDetails {
+			return "", apperrors.Validation("details_not_allowed", "text, releaseDate and link can't be given with source %q", models.SourceProvider)
+		}
+		return models.SourceProvider, nil
+	case models.SourceManual, models.SourceMerge:
+		return newSong.Source, nil
+	default:
+		return "", apperrors.Validation("invalid_source", "source must be one of %q, %q or %q", models.SourceManual, models.SourceProvider, models.SourceMerge)
+	}
+}
+
+// resolveSongDetail builds the details of a new song. With SourceMerge the
+// submitted fields win and the providers only fill the gaps; a song unknown
+// to the providers is then stored with the submitted fields alone.
+func (s *SongService) resolveSongDetail(ctx context.Context, newSong models.NewSongRequest, source string) (*models.SongDetail, error) {
+	manual := &models.SongDetail{Sources: make(map[string]models.FieldOrigin)}
+	origin := models.FieldOrigin{Origin: models.OriginManual}
+	// Lyrics are kept as written, their indentation and blank lines matter.
+	text := deref(newSong.Text)
+	if strings.TrimSpace(text) == "" {
+		text = ""
+	}
+	mergeField(manual, models.FieldText, &manual.Text, text, origin)
+	mergeField(manual, models.FieldReleaseDate, &manual.ReleaseDate, strings.TrimSpace(deref(newSong.ReleaseDate)), origin)
+	mergeField(manual, models.FieldLink, &manual.Link, strings.TrimSpace(deref(newSong.Link)), origin)
+
+	switch source {
+	case models.SourceManual:
+		return manual, nil
+	case models.SourceProvider:
+		return s.fetchSongDetail(ctx, newSong.Group, newSong.Song)
+	}
+
+	if len(manual.Sources) == 3 {
+		return manual, nil
+	}
+
+	fetched, err := s.fetchSongDetail(ctx, newSong.Group, newSong.Song)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrNotFound) {
+			logging.FromContext(ctx).Info("Song unknown to providers, using submitted details", slog.String("group", newSong.Group), slog.String("song", newSong.Song))
+			return manual, nil
+		}
+		return nil, err
+	}
+
+	mergeField(manual, models.FieldText, &manual.Text, fetched.Text, fetched.Sources[models.FieldText])
+	mergeField(manual, models.FieldReleaseDate, &manual.ReleaseDate, fetched.ReleaseDate, fetched.Sources[models.FieldReleaseDate])
+	mergeField(manual, models.FieldLink, &manual.Link, fetched.Link, fetched.Sources[models.FieldLink])
+	return manual, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+// staticFetcher answers every lookup with the same detail or error.
+type staticFetcher struct {
+	detail *models.SongDetail
+	err    error
+	calls  int
+}
+
+func (f *staticFetcher) FetchSongDetail(ctx context.Context, group, song string) (*models.SongDetail, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	detail := *f.detail
+	return &detail, nil
+}
+
+func providers(fetchers ...*staticFetcher) []DetailProvider {
+	names := []string{"first", "second", "third"}
+	var list []DetailProvider
+	for i, fetcher := range fetchers {
+		list = append(list, DetailProvider{Name: names[i], Fetcher: fetcher})
+	}
+	return list
+}
+
+func fromProvider(name string) models.FieldOrigin {
+	return models.FieldOrigin{Origin: models.OriginProvider, Provider: name}
+}
+
+func TestFetchSongDetailMerge(t *testing.T) {
+	var (
+		errNotFound = apperrors.NotFound("song_detail_not_found", "no details")
+		errDown     = apperrors.UpstreamUnavailable("upstream_unavailable", "provider is down")
+	)
+
+	tests := []struct {
+		name     string
+		fetchers []*staticFetcher
+		want     *models.SongDetail
+		wantErr  error
+		// asked lists which providers were called.
+		asked []bool
+	}{
+		{
+			name: "first provider has everything",
+			fetchers: []*staticFetcher{
+				{detail: &models.SongDetail{Text: "lyrics", ReleaseDate: "2009-09-14", Link: "https://a"}},
+				{detail: &models.SongDetail{Text: "other"}},
+			},
+			want: &models.SongDetail{Text: "lyrics", ReleaseDate: "2009-09-14", Link: "https://a", Sources: map[string]models.FieldOrigin{
+				models.FieldText: fromProvider("first"), models.FieldReleaseDate: fromProvider("first"), models.FieldLink: fromProvider("first"),
+			}},
+			asked: []bool{true, false},
+		},
+		{
+			name: "gaps filled field by field",
+			fetchers: []*staticFetcher{
+				{detail: &models.SongDetail{Text: "lyrics"}},
+				{detail: &models.SongDetail{Text: "other", ReleaseDate: "2009"}},
+				{detail: &models.SongDetail{ReleaseDate: "2010", Link: "https://c"}},
+			},
+			want: &models.SongDetail{Text: "lyrics", ReleaseDate: "2009", Link: "https://c", Sources: map[string]models.FieldOrigin{
+				models.FieldText: fromProvider("first"), models.FieldReleaseDate: fromProvider("second"), models.FieldLink: fromProvider("third"),
+			}},
+			asked: []bool{true, true, true},
+		},
+		{
+			name: "failing provider is skipped",
+			fetchers: []*staticFetcher{
+				{err: errDown},
+				{detail: &models.SongDetail{Link: "https://b"}},
+			},
+			want:  &models.SongDetail{Link: "https://b", Sources: map[string]models.FieldOrigin{models.FieldLink: fromProvider("second")}},
+			asked: []bool{true, true},
+		},
+		{
+			name:     "not found everywhere",
+			fetchers: []*staticFetcher{{err: errNotFound}, {err: errNotFound}},
+			wantErr:  apperrors.ErrNotFound,
+			asked:    []bool{true, true},
+		},
+		{
+			name:     "an outage wins over not found",
+			fetchers: []*staticFetcher{{err: errNotFound}, {err: errDown}},
+			wantErr:  apperrors.ErrUpstreamUnavailable,
+			asked:    []bool{true, true},
+		},
+		{
+			name:     "empty answers",
+			fetchers: []*staticFetcher{{detail: &models.SongDetail{}}},
+			wantErr:  apperrors.ErrNotFound,
+			asked:    []bool{true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSongService(nil, providers(tt.fetchers...))
+
+			got, err := s.fetchSongDetail(context.Background(), "Muse", "Uprising")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detail = %+v, want %+v", got, tt.want)
+			}
+			for i, fetcher := range tt.fetchers {
+				if asked := fetcher.calls > 0; asked != tt.asked[i] {
+					t.Errorf("provider %d asked = %v, want %v", i, asked, tt.asked[i])
+				}
+			}
+		})
+	}
+}
+
+func TestResolveSongDetail(t *testing.T) {
+	lyrics := "  Paranoia is in bloom\n\n    The PR transmissions will resume\n"
+	blank := " \n\t"
+	date, link := "2009-09-14", "https://example.com"
+	manual := models.FieldOrigin{Origin: models.OriginManual}
+
+	tests := []struct {
+		name    string
+		request models.NewSongRequest
+		source  string
+		fetcher *staticFetcher
+		want    *models.SongDetail
+		asked   bool
+	}{
+		{
+			name:    "manual lyrics keep their whitespace and source",
+			request: models.NewSongRequest{Text: &lyrics},
+			source:  models.SourceMerge,
+			fetcher: &staticFetcher{detail: &models.SongDetail{Text: "provider lyrics", ReleaseDate: date, Link: link}},
+			want: &models.SongDetail{Text: lyrics, ReleaseDate: date, Link: link, Sources: map[string]models.FieldOrigin{
+				models.FieldText: manual, models.FieldReleaseDate: fromProvider("first"), models.FieldLink: fromProvider("first"),
+			}},
+			asked: true,
+		},
+		{
+			name:    "blank lyrics come from the provider",
+			request: models.NewSongRequest{Text: &blank, Link: &link},
+			source:  models.SourceMerge,
+			fetcher: &staticFetcher{detail: &models.SongDetail{Text: "provider lyrics", Link: "https://other"}},
+			want: &models.SongDetail{Text: "provider lyrics", Link: link, Sources: map[string]models.FieldOrigin{
+				models.FieldText: fromProvider("first"), models.FieldLink: manual,
+			}},
+			asked: true,
+		},
+		{
+			name:    "complete details skip the providers",
+			request: models.NewSongRequest{Text: &lyrics, ReleaseDate: &date, Link: &link},
+			source:  models.SourceMerge,
+			fetcher: &staticFetcher{detail: &models.SongDetail{Text: "provider lyrics"}},
+			want: &models.SongDetail{Text: lyrics, ReleaseDate: date, Link: link, Sources: map[string]models.FieldOrigin{
+				models.FieldText: manual, models.FieldReleaseDate: manual, models.FieldLink: manual,
+			}},
+		},
+		{
+			name:    "song unknown to the providers",
+			request: models.NewSongRequest{Text: &lyrics},
+			source:  models.SourceMerge,
+			fetcher: &staticFetcher{err: apperrors.NotFound("song_detail_not_found", "no details")},
+			want:    &models.SongDetail{Text: lyrics, Sources: map[string]models.FieldOrigin{models.FieldText: manual}},
+			asked:   true,
+		},
+		{
+			name:    "manual source never asks",
+			request: models.NewSongRequest{Text: &lyrics},
+			source:  models.SourceManual,
+			fetcher: &staticFetcher{detail: &models.SongDetail{Link: link}},
+			want:    &models.SongDetail{Text: lyrics, Sources: map[string]models.FieldOrigin{models.FieldText: manual}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSongService(nil, providers(tt.fetcher))
+			tt.request.Group, tt.request.Song = "Muse", "Uprising"
+
+			got, err := s.resolveSongDetail(context.Background(), tt.request, tt.source)
+			if err != nil {
+				t.Fatalf("resolveSongDetail: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detail = %+v, want %+v", got, tt.want)
+			}
+			if asked := tt.fetcher.calls > 0; asked != tt.asked {
+				t.Errorf("provider asked = %v, want %v", asked, tt.asked)
+			}
+		})
+	}
+}
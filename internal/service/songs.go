@@ -6,8 +6,14 @@ import (
 	"log/slog"
 	"strings"
 
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/auth"
+	"github.com/KarmaBeLike/SongLibrary/internal/logging"
 	"github.com/KarmaBeLike/SongLibrary/internal/models"
+	"github.com/KarmaBeLike/SongLibrary/internal/tracing"
 	"github.com/KarmaBeLike/SongLibrary/pkg/validation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
@@ -21,29 +27,61 @@ type (
 		DeleteSongByID(ctx context.Context, id int) error
 		UpdateSongByID(ctx context.Context, id int, updateRequest *models.UpdateSongRequest) error
 		AddSong(ctx context.Context, group, song string, songDetail *models.SongDetail) (int, error)
+		AddPendingSong(ctx context.Context, group, song string, maxAttempts int) (int, int, error)
+		GetIncompleteSongs(ctx context.Context, afterID, limit int) ([]models.Song, error)
+		ApplySongDetails(ctx context.Context, id int, songDetail *models.SongDetail, opts models.ApplyOptions) ([]string, error)
+		GetFieldProvenance(ctx context.Context, id int) ([]models.FieldProvenance, error)
 		GetOrCreateGroup(ctx context.Context, groupName string) (int, error)
 	}
 
+	// DetailProvider is a named source of song details.
+	DetailProvider struct {
+		Name    string
+		Fetcher SongDetailFetcher
+	}
+
 	SongService struct {
-		storage SongStorage
-		api     SongDetailFetcher
+		storage   SongStorage
+		providers []DetailProvider
+		// enrichAttempts limits how often details of an asynchronously added song are fetched.
+		enrichAttempts int
 	}
+
+	Option func(*SongService)
 )
 
-func NewSongService(storage SongStorage, api SongDetailFetcher) *SongService {
-	return &SongService{
-		storage: storage,
-		api:     api,
+// NewSongService creates the service. Providers are asked for song details
+// in the given order.
+func NewSongService(storage SongStorage, providers []DetailProvider, opts ...Option) *SongService {
+	s := &SongService{
+		storage:        storage,
+		providers:      providers,
+		enrichAttempts: 5,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func WithEnrichAttempts(n int) Option {
+	return func(s *SongService) {
+		if n > 0 {
+			s.enrichAttempts = n
+		}
 	}
 }
 
-func (s *SongService) GetSongs(ctx context.Context, filter models.SongFilter) ([]models.Song, models.Pagination, error) {
-	slog.Debug("Fetching songs", slog.Any("filter", filter))
+func (s *SongService) GetSongs(ctx context.Context, filter models.SongFilter) (_ []models.Song, _ models.Pagination, err error) {
+	ctx, span := tracing.Start(ctx, "SongService.GetSongs")
+	defer func() { tracing.End(span, err) }()
+
+	logging.FromContext(ctx).Debug("Fetching songs", slog.Any("filter", filter))
 
 	// Получение песен через репозиторий с фильтром
 	songs, err := s.storage.GetSongsByFilter(ctx, filter)
 	if err != nil {
-		slog.Error("Error fetching songs", slog.Any("filter", filter), slog.Any("error", err))
+		logging.FromContext(ctx).Error("Error fetching songs", slog.Any("filter", filter), slog.Any("error", err))
 		return nil, models.Pagination{}, err
 	}
 
@@ -67,22 +105,25 @@ func (s *SongService) GetSongs(ctx context.Context, filter models.SongFilter) ([
 		Total: total,
 	}
 
-	slog.Info("Songs fetched successfully", slog.Int("total", total), slog.Int("returned_count", len(paginatedSongs)))
+	logging.FromContext(ctx).Info("Songs fetched successfully", slog.Int("total", total), slog.Int("returned_count", len(paginatedSongs)))
 	return paginatedSongs, pagination, nil
 }
 
-func (s *SongService) GetPaginatedSongLyrics(ctx context.Context, id int, page, limit int) (*models.SongVerses, error) {
-	slog.Debug("Fetching song lyrics", slog.Int("song_id", id), slog.Int("page", page), slog.Int("limit", limit))
+func (s *SongService) GetPaginatedSongLyrics(ctx context.Context, id int, page, limit int) (_ *models.SongVerses, err error) {
+	ctx, span := tracing.Start(ctx, "SongService.GetPaginatedSongLyrics")
+	defer func() { tracing.End(span, err) }()
+
+	logging.FromContext(ctx).Debug("Fetching song lyrics", slog.Int("song_id", id), slog.Int("page", page), slog.Int("limit", limit))
 
 	song, err := s.storage.GetSongByID(ctx, id)
 	if err != nil {
-		slog.Error("Error fetching song by ID", slog.Int("song_id", id), slog.Any("error", err))
+		logging.FromContext(ctx).Error("Error fetching song by ID", slog.Int("song_id", id), slog.Any("error", err))
 		return nil, err
 	}
 
 	if song.Text == nil {
-		slog.Warn("Text not found for song", slog.Int("song_id", id))
-		return nil, fmt.Errorf("lyrics not found for song ID %d", id)
+		logging.FromContext(ctx).Warn("Text not found for song", slog.Int("song_id", id))
+		return nil, apperrors.NotFound("lyrics_not_found", "lyrics not found for song ID %d", id)
 	}
 
 	verses := strings.Split(*song.Text, "\n\n")
@@ -97,8 +138,8 @@ func (s *SongService) GetPaginatedSongLyrics(ctx context.Context, id int, page,
 	end := start + limit
 
 	if start >= totalVerses || start < 0 {
-		slog.Warn("Page out of range", slog.Int("page", page), slog.Int("total_verses", totalVerses))
-		return nil, fmt.Errorf("page out of range")
+		logging.FromContext(ctx).Warn("Page out of range", slog.Int("page", page), slog.Int("total_verses", totalVerses))
+		return nil, apperrors.NotFound("page_out_of_range", "page %d is out of range, song has %d verses", page, totalVerses)
 	}
 
 	if end > totalVerses {
@@ -115,57 +156,237 @@ func (s *SongService) GetPaginatedSongLyrics(ctx context.Context, id int, page,
 		Total:  len(verses),
 	}
 
-	slog.Info("Text fetched successfully", slog.Int("song_id", id), slog.Int("returned_verses", len(paginatedVerses)))
+	logging.FromContext(ctx).Info("Text fetched successfully", slog.Int("song_id", id), slog.Int("returned_verses", len(paginatedVerses)))
 	return response, nil
 }
 
-func (s *SongService) DeleteSongByID(ctx context.Context, id int) error {
-	slog.Debug("Deleting song by ID", slog.Int("song_id", id))
+func (s *SongService) DeleteSongByID(ctx context.Context, id int) (err error) {
+	ctx, span := tracing.Start(ctx, "SongService.DeleteSongByID")
+	defer func() { tracing.End(span, err) }()
 
-	err := s.storage.DeleteSongByID(ctx, id)
+	logging.FromContext(ctx).Debug("Deleting song by ID", slog.Int("song_id", id))
+
+	err = s.storage.DeleteSongByID(ctx, id)
 	if err != nil {
-		slog.Error("Error deleting song", slog.Int("song_id", id), slog.Any("error", err))
+		logging.FromContext(ctx).Error("Error deleting song", slog.Int("song_id", id), slog.Any("error", err))
 		return fmt.Errorf("failed to delete song: %w", err)
 	}
-	slog.Info("Song deleted successfully", slog.Int("song_id", id))
+	logging.FromContext(ctx).Info("Song deleted successfully", slog.Int("song_id", id), actor(ctx))
 	return nil
 }
 
-func (s *SongService) UpdateSongByID(ctx context.Context, id int, updateRequest *models.UpdateSongRequest) error {
-	slog.Debug("Updating song by ID", slog.Int("song_id", id), slog.Any("updateRequest", updateRequest))
-	err := s.storage.UpdateSongByID(ctx, id, updateRequest)
+func (s *SongService) UpdateSongByID(ctx context.Context, id int, updateRequest *models.UpdateSongRequest) (err error) {
+	ctx, span := tracing.Start(ctx, "SongService.UpdateSongByID")
+	defer func() { tracing.End(span, err) }()
+
+	logging.FromContext(ctx).Debug("Updating song by ID", slog.Int("song_id", id), slog.Any("updateRequest", updateRequest))
+	err = s.storage.UpdateSongByID(ctx, id, updateRequest)
 	if err != nil {
-		slog.Error("Error updating song", slog.Int("song_id", id), slog.Any("error", err))
+		logging.FromContext(ctx).Error("Error updating song", slog.Int("song_id", id), slog.Any("error", err))
 		return err
 	}
 
-	slog.Info("Song updated successfully", slog.Int("song_id", id))
+	logging.FromContext(ctx).Info("Song updated successfully", slog.Int("song_id", id), actor(ctx))
 	return nil
 }
 
-func (s *SongService) AddSong(ctx context.Context, newSong models.NewSongRequest) (int, error) {
-	slog.Info("Adding new song", slog.String("group", newSong.Group), slog.String("song", newSong.Song))
+func (s *SongService) AddSong(ctx context.Context, newSong models.NewSongRequest) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "SongService.AddSong", trace.WithAttributes(
+		attribute.String("song.group", newSong.Group),
+		attribute.String("song.name", newSong.Song),
+		attribute.String("song.source", newSong.Source),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	logging.FromContext(ctx).Info("Adding new song", slog.String("group", newSong.Group), slog.String("song", newSong.Song), slog.String("source", newSong.Source))
 
-	// 2. Получить детали песни из внешнего API
-	songDetail, err := s.api.FetchSongDetail(ctx, newSong.Group, newSong.Song)
+	if strings.TrimSpace(newSong.Group) == "" || strings.TrimSpace(newSong.Song) == "" {
+		return 0, apperrors.Validation("missing_fields", "group and song are required")
+	}
+
+	source, err := songSource(newSong)
+	if err != nil {
+		return 0, err
+	}
+
+	// 2. Получить детали песни из внешнего API и/или из запроса
+	songDetail, err := s.resolveSongDetail(ctx, newSong, source)
 	if err != nil {
-		slog.Error("Failed to fetch song detail", slog.Any("error", err))
-		return 0, fmt.Errorf("failed to fetch song detail: %w", err)
+		logging.FromContext(ctx).Error("Failed to fetch song detail", slog.Any("error", err))
+		if _, ok := apperrors.As(err); ok {
+			return 0, err
+		}
+		return 0, apperrors.UpstreamUnavailable("song_detail_unavailable", "failed to fetch song detail").Wrap(err)
 	}
 
-	// 3. Проверить текст песни, если нужно
-	if err := validation.ValidateSongText(songDetail.Text); err != nil {
-		slog.Error("Song text validation failed", slog.Any("error", err))
-		return 0, fmt.Errorf("song text validation error: %w", err)
+	// 3. Проверить текст песни, если нужно. Без провайдера текст можно добавить позже.
+	if source == models.SourceProvider || songDetail.Text != "" {
+		if err := validateText(ctx, songDetail.Text); err != nil {
+			logging.FromContext(ctx).Error("Song text validation failed", slog.Any("error", err))
+			return 0, apperrors.Validation("invalid_lyrics", "song text validation error: %v", err).Wrap(err)
+		}
 	}
 
 	// 4. Добавить песню в базу данных
 	songID, err := s.storage.AddSong(ctx, newSong.Group, newSong.Song, songDetail)
 	if err != nil {
-		slog.Error("Failed to add song to the database", slog.Any("error", err))
+		logging.FromContext(ctx).Error("Failed to add song to the database", slog.Any("error", err))
 		return 0, err
 	}
 
-	slog.Info("Successfully added song to the database", slog.Int("songID", songID))
+	logging.FromContext(ctx).Info("Successfully added song to the database", slog.Int("songID", songID), actor(ctx))
 	return songID, nil
 }
+
+// AddSongAsync stores the song right away in the pending state and queues a
+// job that fetches its details. It returns the song and job IDs.
+func (s *SongService) AddSongAsync(ctx context.Context, newSong models.NewSongRequest) (_ int, _ int, err error) {
+	ctx, span := tracing.Start(ctx, "SongService.AddSongAsync")
+	defer func() { tracing.End(span, err) }()
+
+	logging.FromContext(ctx).Info("Adding new song asynchronously", slog.String("group", newSong.Group), slog.String("song", newSong.Song))
+
+	if strings.TrimSpace(newSong.Group) == "" || strings.TrimSpace(newSong.Song) == "" {
+		return 0, 0, apperrors.Validation("missing_fields", "group and song are required")
+	}
+
+	if source, err := songSource(newSong); err != nil {
+		return 0, 0, err
+	} else if source != models.SourceProvider {
+		return 0, 0, apperrors.Validation("async_requires_provider", "only songs with source %q can be added asynchronously", models.SourceProvider)
+	}
+
+	songID, jobID, err := s.storage.AddPendingSong(ctx, newSong.Group, newSong.Song, s.enrichAttempts)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to add pending song", slog.Any("error", err))
+		return 0, 0, err
+	}
+
+	logging.FromContext(ctx).Info("Pending song added", slog.Int("songID", songID), slog.Int("jobID", jobID))
+	return songID, jobID, nil
+}
+
+// EnrichSong fetches and stores the details of a pending song.
+func (s *SongService) EnrichSong(ctx context.Context, id int) (err error) {
+	ctx, span := tracing.Start(ctx, "SongService.EnrichSong")
+	defer func() { tracing.End(span, err) }()
+
+	song, err := s.storage.GetSongByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	songDetail, err := s.fetchSongDetail(ctx, song.Group, song.Song)
+	if err != nil {
+		return err
+	}
+
+	if err := validateText(ctx, songDetail.Text); err != nil {
+		return apperrors.Validation("invalid_lyrics", "song text validation error: %v", err).Wrap(err)
+	}
+
+	_, err = s.storage.ApplySongDetails(ctx, id, songDetail, models.ApplyOptions{MarkReady: true})
+	return err
+}
+
+func (s *SongService) GetIncompleteSongs(ctx context.Context, afterID, limit int) ([]models.Song, error) {
+	return s.storage.GetIncompleteSongs(ctx, afterID, limit)
+}
+
+// ResyncSong refetches the details of a song and fills in the fields that are
+// still empty, values already stored are never replaced. It returns the names
+// of the filled fields.
+func (s *SongService) ResyncSong(ctx context.Context, song models.Song) (_ []string, err error) {
+	ctx, span := tracing.Start(ctx, "SongService.ResyncSong")
+	defer func() { tracing.End(span, err) }()
+
+	songDetail, err := s.fetchValidSongDetail(ctx, song)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.storage.ApplySongDetails(ctx, song.ID, songDetail, models.ApplyOptions{OnlyEmpty: true})
+}
+
+// RefreshSong refetches the details of a song and replaces the stored values
+// with them. Manually set fields are kept unless force is set. It returns the
+// names of the updated fields.
+func (s *SongService) RefreshSong(ctx context.Context, id int, force bool) (_ []string, err error) {
+	ctx, span := tracing.Start(ctx, "SongService.RefreshSong")
+	defer func() { tracing.End(span, err) }()
+
+	song, err := s.storage.GetSongByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	songDetail, err := s.fetchValidSongDetail(ctx, song)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := s.storage.ApplySongDetails(ctx, id, songDetail, models.ApplyOptions{Force: force})
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to refresh song", slog.Int("song_id", id), slog.Any("error", err))
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("Song refreshed", slog.Int("song_id", id), slog.Bool("force", force), slog.Any("fields", fields))
+	return fields, nil
+}
+
+// GetSongInfo returns the song together with the origin of its fields.
+func (s *SongService) GetSongInfo(ctx context.Context, id int) (_ *models.SongInfo, err error) {
+	ctx, span := tracing.Start(ctx, "SongService.GetSongInfo")
+	defer func() { tracing.End(span, err) }()
+
+	song, err := s.storage.GetSongByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	provenance, err := s.storage.GetFieldProvenance(ctx, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to fetch field provenance", slog.Int("song_id", id), slog.Any("error", err))
+		return nil, err
+	}
+
+	return &models.SongInfo{Song: song, Provenance: provenance}, nil
+}
+
+// actor describes who made a change: a user, an API key or nobody when
+// authentication is off.
+func actor(ctx context.Context) slog.Attr {
+	identity := auth.IdentityFromContext(ctx)
+	if identity == nil {
+		return slog.String("actor", "anonymous")
+	}
+	return slog.Group("actor", slog.String("kind", identity.Kind), slog.Int("id", identity.ID))
+}
+
+// fetchValidSongDetail fetches the details of a stored song. Invalid text from
+// a provider is dropped, the other fields are still used.
+func (s *SongService) fetchValidSongDetail(ctx context.Context, song models.Song) (*models.SongDetail, error) {
+	songDetail, err := s.fetchSongDetail(ctx, song.Group, song.Song)
+	if err != nil {
+		return nil, err
+	}
+
+	if songDetail.Text != "" {
+		if err := validateText(ctx, songDetail.Text); err != nil {
+			logging.FromContext(ctx).Warn("Ignoring invalid song text from provider", slog.Int("song_id", song.ID), slog.Any("error", err))
+			songDetail.Text = ""
+			delete(songDetail.Sources, models.FieldText)
+		}
+	}
+	return songDetail, nil
+}
+
+// validateText checks the lyrics in a span of their own, so slow validation
+// of long texts shows up in traces.
+func validateText(ctx context.Context, text string) error {
+	_, span := tracing.Start(ctx, "validation.ValidateSongText", trace.WithAttributes(attribute.Int("text.length", len(text))))
+	err := validation.ValidateSongText(text)
+	tracing.End(span, err)
+	return err
+}
@@ -0,0 +1,327 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	mrand "math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+// Headers sent with every delivery. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)).
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+type (
+	Storage interface {
+		CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error
+		ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+		DeleteSubscription(ctx context.Context, id int) error
+		EnqueueDeliveries(ctx context.Context, event models.Event, payload []byte, maxAttempts int) (int, error)
+		ClaimDelivery(ctx context.Context, owner string, lease time.Duration) (*models.WebhookDelivery, error)
+		CompleteDelivery(ctx context.Context, id int, owner string, responseStatus int) error
+		RetryDelivery(ctx context.Context, id int, owner string, nextAttempt time.Time, responseStatus *int, lastError string) error
+		FailDelivery(ctx context.Context, id int, owner string, responseStatus *int, lastError string) error
+		ListDeliveries(ctx context.Context, subscriptionID, limit int) ([]models.WebhookDelivery, error)
+		Redeliver(ctx context.Context, id, maxAttempts int) (*models.WebhookDelivery, error)
+	}
+
+	Config struct {
+		Workers      int
+		MaxAttempts  int
+		Timeout      time.Duration
+		PollInterval time.Duration
+		// RetryDelay is the pause after the first failed attempt, it doubles
+		// with every further attempt up to MaxRetryDelay.
+		RetryDelay    time.Duration
+		MaxRetryDelay time.Duration
+		// AllowPrivateTargets lets subscriptions point to loopback and private
+		// addresses, for local development only.
+		AllowPrivateTargets bool
+	}
+
+	// Dispatcher turns song events into webhook deliveries and sends them in
+	// the background, so publishing never waits for a subscriber.
+	Dispatcher struct {
+		store    Storage
+		client   *http.Client
+		resolver *net.Resolver
+		cfg      Config
+		// id tells the leases of this dispatcher apart from those of other instances.
+		id string
+		wg sync.WaitGroup
+	}
+)
+
+func NewDispatcher(store Storage, cfg Config) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 2
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = 10 * time.Second
+	}
+	if cfg.MaxRetryDelay <= 0 {
+		cfg.MaxRetryDelay = time.Hour
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateTargets {
+		dialer.Control = dialPublic
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// A proxy would be dialed instead of the subscriber and hide its address.
+	transport.Proxy = nil
+
+	return &Dispatcher{
+		store:    store,
+		client:   &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		resolver: net.DefaultResolver,
+		cfg:      cfg,
+		id:       fmt.Sprintf("%016x", mrand.Uint64()),
+	}
+}
+
+// Publish queues a delivery of the event to every interested subscription.
+func (d *Dispatcher) Publish(ctx context.Context, event models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+
+	n, err := d.store.EnqueueDeliveries(ctx, event, payload, d.cfg.MaxAttempts)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		slog.Debug("Webhook deliveries queued", slog.String("event_id", event.ID), slog.String("event_type", event.Type), slog.Int("deliveries", n))
+	}
+	return nil
+}
+
+func (d *Dispatcher) CreateSubscription(ctx context.Context, req models.NewWebhookRequest) (*models.WebhookSubscription, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, apperrors.Validation("invalid_webhook_url", "url must be an absolute http or https URL")
+	}
+	if !d.cfg.AllowPrivateTargets {
+		if err := checkTarget(ctx, d.resolver, u); err != nil {
+			return nil, err
+		}
+	}
+	for _, eventType := range req.EventTypes {
+		if !slices.Contains(models.EventTypes, eventType) {
+			return nil, apperrors.Validation("invalid_event_type", "unknown event type %q, expected one of %v", eventType, models.EventTypes)
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = newSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	sub := &models.WebhookSubscription{
+		URL:        req.URL,
+		Secret:     secret,
+		EventTypes: req.EventTypes,
+	}
+	if sub.EventTypes == nil {
+		sub.EventTypes = []string{}
+	}
+	if err := d.store.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Webhook subscription created", slog.Int("subscription_id", sub.ID), slog.String("url", sub.URL), slog.Any("event_types", sub.EventTypes))
+	return sub, nil
+}
+
+func (d *Dispatcher) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	return d.store.ListSubscriptions(ctx)
+}
+
+func (d *Dispatcher) DeleteSubscription(ctx context.Context, id int) error {
+	return d.store.DeleteSubscription(ctx, id)
+}
+
+func (d *Dispatcher) ListDeliveries(ctx context.Context, subscriptionID, limit int) ([]models.WebhookDelivery, error) {
+	return d.store.ListDeliveries(ctx, subscriptionID, limit)
+}
+
+// Redeliver sends the event of a past delivery again as a new delivery.
+func (d *Dispatcher) Redeliver(ctx context.Context, id int) (*models.WebhookDelivery, error) {
+	return d.store.Redeliver(ctx, id, d.cfg.MaxAttempts)
+}
+
+// Start launches the delivery workers. They stop when ctx is cancelled, Wait
+// blocks until they have.
+func (d *Dispatcher) Start(ctx context.Context) {
+	slog.Info("Starting webhook workers", slog.Int("workers", d.cfg.Workers))
+
+	for i := 0; i < d.cfg.Workers; i++ {
+		owner := fmt.Sprintf("%s-%d", d.id, i)
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.run(ctx, owner)
+		}()
+	}
+}
+
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) run(ctx context.Context, owner string) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil && d.deliverNext(ctx, owner) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverNext sends one delivery and reports whether there was one.
+func (d *Dispatcher) deliverNext(ctx context.Context, owner string) bool {
+	// The lease covers the request timeout with some room to store the outcome.
+	delivery, err := d.store.ClaimDelivery(ctx, owner, 2*d.cfg.Timeout)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Failed to claim webhook delivery", slog.Any("error", err))
+		}
+		return false
+	}
+	if delivery == nil {
+		return false
+	}
+
+	logger := slog.With(slog.Int("delivery_id", delivery.ID), slog.Int("subscription_id", delivery.SubscriptionID),
+		slog.String("event_type", delivery.EventType), slog.Int("attempt", delivery.Attempts))
+
+	status, err := d.send(ctx, delivery)
+
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	var responseStatus *int
+	if status != 0 {
+		responseStatus = &status
+	}
+
+	var storeErr error
+	switch {
+	case err == nil:
+		logger.Info("Webhook delivered", slog.Int("status", status))
+		storeErr = d.store.CompleteDelivery(storeCtx, delivery.ID, owner, status)
+	case delivery.Attempts >= delivery.MaxAttempts:
+		logger.Warn("Webhook delivery failed", slog.Any("error", err))
+		storeErr = d.store.FailDelivery(storeCtx, delivery.ID, owner, responseStatus, err.Error())
+	default:
+		next := time.Now().Add(d.retryDelay(delivery.Attempts))
+		logger.Warn("Webhook delivery failed, will retry", slog.Time("next_attempt_at", next), slog.Any("error", err))
+		storeErr = d.store.RetryDelivery(storeCtx, delivery.ID, owner, next, responseStatus, err.Error())
+	}
+
+	switch {
+	case errors.Is(storeErr, apperrors.ErrConflict):
+		// The lease ran out while sending, another worker owns the delivery now.
+		logger.Warn("Webhook delivery lease lost, outcome dropped", slog.Any("error", storeErr))
+	case storeErr != nil:
+		logger.Error("Failed to store webhook delivery outcome", slog.Any("error", storeErr))
+	}
+
+	return true
+}
+
+// send posts the delivery and returns the response status, zero if there
+// was no response.
+func (d *Dispatcher) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) retryDelay(attempt int) time.Duration {
+	delay := d.cfg.RetryDelay
+	for i := 1; i < attempt && delay < d.cfg.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, d.cfg.MaxRetryDelay)
+}
+
+// Sign returns the signature header value for a payload sent at timestamp.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
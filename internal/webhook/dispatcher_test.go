@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+	"github.com/KarmaBeLike/SongLibrary/internal/models"
+)
+
+// memoryStore hands out one delivery and records its outcome.
+type memoryStore struct {
+	Storage
+	delivery *models.WebhookDelivery
+	created  []*models.WebhookSubscription
+
+	owner     string
+	outcome   string
+	status    *int
+	lastError string
+}
+
+func (m *memoryStore) CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	m.created = append(m.created, sub)
+	return nil
+}
+
+func (m *memoryStore) ClaimDelivery(ctx context.Context, owner string, lease time.Duration) (*models.WebhookDelivery, error) {
+	delivery := m.delivery
+	m.delivery = nil
+	return delivery, nil
+}
+
+func (m *memoryStore) CompleteDelivery(ctx context.Context, id int, owner string, responseStatus int) error {
+	m.owner, m.outcome, m.status = owner, "delivered", &responseStatus
+	return nil
+}
+
+func (m *memoryStore) RetryDelivery(ctx context.Context, id int, owner string, nextAttempt time.Time, responseStatus *int, lastError string) error {
+	m.owner, m.outcome, m.status, m.lastError = owner, "retry", responseStatus, lastError
+	return nil
+}
+
+func (m *memoryStore) FailDelivery(ctx context.Context, id int, owner string, responseStatus *int, lastError string) error {
+	m.owner, m.outcome, m.status, m.lastError = owner, "failed", responseStatus, lastError
+	return nil
+}
+
+func TestSign(t *testing.T) {
+	got := Sign("secret", "1700000000", []byte(`{"id":"1"}`))
+	if want := "sha256=086f6aff7bd084c98679825129c5a64dbad88c760016d6d2c0fb123f27951d54"; got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if Sign("other", "1700000000", []byte(`{"id":"1"}`)) == got {
+		t.Error("signature does not depend on the secret")
+	}
+	if Sign("secret", "1700000001", []byte(`{"id":"1"}`)) == got {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1::1", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := publicIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("publicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSubscriptionTarget(t *testing.T) {
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		// Names that do not resolve yet are checked when sending.
+		{"https://hooks.example.com/songs", true},
+		{"http://localhost:8080/hook", false},
+		{"http://api.LOCALHOST/hook", false},
+		{"http://127.0.0.1/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://192.168.0.10:9000/hook", false},
+		{"ftp://example.com/hook", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			store := &memoryStore{}
+			d := NewDispatcher(store, Config{})
+			// Keep the test off the network, every lookup fails.
+			d.resolver = &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return nil, errors.New("no network in tests")
+			}}
+
+			_, err := d.CreateSubscription(context.Background(), models.NewWebhookRequest{URL: tt.url})
+			if tt.allowed {
+				if err != nil || len(store.created) != 1 {
+					t.Fatalf("refused: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, apperrors.ErrValidation) || len(store.created) != 0 {
+				t.Errorf("err = %v, want a validation error", err)
+			}
+		})
+	}
+}
+
+func TestDeliverNext(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	delivery := func() *models.WebhookDelivery {
+		return &models.WebhookDelivery{ID: 3, EventType: models.EventSongCreated, Attempts: 1, MaxAttempts: 3,
+			URL: server.URL, Secret: "secret", Payload: []byte(`{"id":"1"}`)}
+	}
+
+	t.Run("signed delivery", func(t *testing.T) {
+		store := &memoryStore{delivery: delivery()}
+		d := NewDispatcher(store, Config{AllowPrivateTargets: true})
+
+		if !d.deliverNext(context.Background(), "worker-0") {
+			t.Fatal("no delivery claimed")
+		}
+		if store.outcome != "delivered" || store.owner != "worker-0" || *store.status != http.StatusNoContent {
+			t.Fatalf("outcome %q by %q, status %v", store.outcome, store.owner, store.status)
+		}
+		timestamp := got.Get(HeaderTimestamp)
+		if want := Sign("secret", timestamp, []byte(`{"id":"1"}`)); got.Get(HeaderSignature) != want {
+			t.Errorf("signature = %q, want %q", got.Get(HeaderSignature), want)
+		}
+		if got.Get(HeaderEvent) != models.EventSongCreated || got.Get(HeaderDelivery) != "3" {
+			t.Errorf("headers = %v", got)
+		}
+	})
+
+	t.Run("private address refused when sending", func(t *testing.T) {
+		got = nil
+		store := &memoryStore{delivery: delivery()}
+		d := NewDispatcher(store, Config{})
+
+		d.deliverNext(context.Background(), "worker-0")
+		if got != nil {
+			t.Fatal("request reached the loopback server")
+		}
+		if store.outcome != "retry" || store.status != nil || !strings.Contains(store.lastError, "not a public address") {
+			t.Errorf("outcome %q, status %v, error %q", store.outcome, store.status, store.lastError)
+		}
+	})
+}
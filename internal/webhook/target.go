@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/KarmaBeLike/SongLibrary/internal/apperrors"
+)
+
+// publicIP reports whether deliveries may go to ip. Loopback, private,
+// link-local (which includes cloud metadata at 169.254.169.254), unspecified
+// and multicast addresses reach into the server's own network.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// checkTarget refuses subscription URLs that name or resolve to an internal
+// address. A host that does not resolve yet is accepted; the dialer checks
+// every address again when sending, as DNS may change until then.
+func checkTarget(ctx context.Context, resolver *net.Resolver, u *url.URL) error {
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return apperrors.Validation("webhook_url_not_public", "url must not point to localhost")
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicIP(ip) {
+			return apperrors.Validation("webhook_url_not_public", "url must not point to the internal address %s", ip)
+		}
+		return nil
+	}
+
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return apperrors.Validation("webhook_url_not_public", "url host %s resolves to the internal address %s", host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// dialPublic is a net.Dialer Control function that refuses connections to
+// internal addresses after DNS resolution.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("webhook target %s is not a public address", host)
+	}
+	return nil
+}
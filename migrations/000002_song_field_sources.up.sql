@@ -0,0 +1,12 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS song_field_sources (
+    song_id BIGINT NOT NULL,
+    field VARCHAR(32) NOT NULL,
+    provider VARCHAR(255) NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (song_id, field),
+    FOREIGN KEY (song_id) REFERENCES songs (song_id) ON DELETE CASCADE
+);
+
+COMMIT;
@@ -0,0 +1,23 @@
+BEGIN;
+
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'ready';
+
+CREATE TABLE IF NOT EXISTS enrichment_jobs (
+    job_id bigserial PRIMARY KEY,
+    song_id BIGINT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'queued',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- The worker holding the lease of a running job until locked_until.
+    locked_by VARCHAR(64),
+    locked_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    FOREIGN KEY (song_id) REFERENCES songs (song_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_enrichment_jobs_status ON enrichment_jobs(status, next_attempt_at);
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS sync_runs (
+    run_id bigserial PRIMARY KEY,
+    status VARCHAR(16) NOT NULL,
+    songs_checked INT NOT NULL DEFAULT 0,
+    songs_updated INT NOT NULL DEFAULT 0,
+    songs_skipped INT NOT NULL DEFAULT 0,
+    songs_failed INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_runs_started_at ON sync_runs(started_at);
+
+COMMIT;
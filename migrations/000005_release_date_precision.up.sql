@@ -0,0 +1,9 @@
+BEGIN;
+
+-- day, month or year. Dates known to a month or a year are stored as the
+-- first day of that period. NULL precision means day.
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS release_date_precision VARCHAR(8);
+
+UPDATE songs SET release_date_precision = 'day' WHERE release_date IS NOT NULL AND release_date_precision IS NULL;
+
+COMMIT;
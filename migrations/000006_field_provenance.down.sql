@@ -0,0 +1,4 @@
+DELETE FROM song_field_sources WHERE provider IS NULL;
+
+ALTER TABLE song_field_sources ALTER COLUMN provider SET NOT NULL;
+ALTER TABLE song_field_sources DROP COLUMN IF EXISTS origin;
@@ -0,0 +1,22 @@
+BEGIN;
+
+-- origin is provider, manual or import; provider is only set for provider values.
+ALTER TABLE song_field_sources ADD COLUMN IF NOT EXISTS origin VARCHAR(16) NOT NULL DEFAULT 'provider';
+ALTER TABLE song_field_sources ALTER COLUMN provider DROP NOT NULL;
+
+UPDATE song_field_sources SET origin = 'manual', provider = NULL WHERE provider = 'manual';
+
+-- Songs that existed before provenance was tracked came from imports.
+INSERT INTO song_field_sources (song_id, field, origin, provider)
+SELECT song_id, 'text', 'import', NULL FROM songs WHERE lyrics <> ''
+ON CONFLICT (song_id, field) DO NOTHING;
+
+INSERT INTO song_field_sources (song_id, field, origin, provider)
+SELECT song_id, 'releaseDate', 'import', NULL FROM songs WHERE release_date IS NOT NULL
+ON CONFLICT (song_id, field) DO NOTHING;
+
+INSERT INTO song_field_sources (song_id, field, origin, provider)
+SELECT song_id, 'link', 'import', NULL FROM songs WHERE link IS NOT NULL AND link <> ''
+ON CONFLICT (song_id, field) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Change events written in the same transaction as the change, the relay
+-- publishes them in outbox_id order and sets published_at. xid is the
+-- writing transaction: the relay skips rows of transactions that may still
+-- be in flight, they could hold smaller outbox_ids not yet visible.
+CREATE TABLE IF NOT EXISTS outbox (
+    outbox_id bigserial PRIMARY KEY,
+    xid xid8 NOT NULL DEFAULT pg_current_xact_id(),
+    event_id VARCHAR(64) NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(outbox_id) WHERE published_at IS NULL;
+
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+
+-- Only the SHA-256 of a key is stored, prefix identifies it in listings.
+CREATE TABLE IF NOT EXISTS api_keys (
+    key_id bigserial PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+COMMIT;
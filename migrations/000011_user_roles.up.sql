@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'viewer'
+    CHECK (role IN ('viewer', 'contributor', 'editor', 'admin'));
+
+COMMIT;
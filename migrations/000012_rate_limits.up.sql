@@ -0,0 +1,13 @@
+BEGIN;
+
+-- Token buckets shared by all instances, see internal/ratelimit.
+CREATE TABLE IF NOT EXISTS rate_limits (
+    bucket_key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    allowed BOOLEAN NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limits_updated_at_idx ON rate_limits (updated_at);
+
+COMMIT;
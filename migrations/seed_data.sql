@@ -45,3 +45,13 @@ INSERT INTO songs (group_id, group_name, song, lyrics, release_date, link) VALUE
 (10, 'Led Zeppelin', 'Kashmir', '', '1975-02-24', NULL)
 ON CONFLICT (song) DO NOTHING;
 
+-- Происхождение полей тестовых песен
+INSERT INTO song_field_sources (song_id, field, origin, provider)
+SELECT song_id, 'releaseDate', 'import', NULL FROM songs
+WHERE release_date IS NOT NULL AND song IN (
+    'Hysteria', 'Creep', 'Karma Police', 'Smells Like Teen Spirit', 'Come as You Are',
+    'Hey Jude', 'Let It Be', 'Fix You', 'Viva La Vida', 'Numb', 'In the End',
+    'Bohemian Rhapsody', 'We Will Rock You', 'Comfortably Numb', 'Wish You Were Here',
+    'Paint It Black', 'Angie', 'Stairway to Heaven', 'Kashmir'
+)
+ON CONFLICT (song_id, field) DO NOTHING;
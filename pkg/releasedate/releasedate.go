@@ -0,0 +1,111 @@
+package releasedate
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Precision tells which parts of a release date are known.
+type Precision string
+
+const (
+	PrecisionDay   Precision = "day"
+	PrecisionMonth Precision = "month"
+	PrecisionYear  Precision = "year"
+)
+
+var ErrInvalidDate = errors.New("release date must be YYYY-MM-DD, DD.MM.YYYY, YYYY-MM or YYYY")
+
+// Date is a release date known to some precision. Unknown parts are set to
+// the first month or day.
+type Date struct {
+	Time      time.Time
+	Precision Precision
+}
+
+var layouts = []struct {
+	layout    string
+	precision Precision
+}{
+	{"2006-01-02", PrecisionDay},
+	{time.RFC3339, PrecisionDay},
+	{"02.01.2006", PrecisionDay},
+	{"2006-01", PrecisionMonth},
+	{"2006", PrecisionYear},
+}
+
+// Parse accepts ISO dates (YYYY-MM-DD or a full RFC 3339 timestamp),
+// DD.MM.YYYY, YYYY-MM and YYYY.
+func Parse(value string) (Date, error) {
+	value = strings.TrimSpace(value)
+	for _, l := range layouts {
+		if t, err := time.Parse(l.layout, value); err == nil {
+			return New(t, l.precision), nil
+		}
+	}
+	return Date{}, ErrInvalidDate
+}
+
+// ParseLayout parses value with a custom Go layout. The precision follows
+// from the parts the layout contains.
+func ParseLayout(value, layout string) (Date, error) {
+	t, err := time.Parse(layout, strings.TrimSpace(value))
+	if err != nil {
+		return Date{}, err
+	}
+	return New(t, layoutPrecision(layout)), nil
+}
+
+// New truncates t to the precision.
+func New(t time.Time, precision Precision) Date {
+	year, month, day := t.Date()
+	switch precision {
+	case PrecisionYear:
+		month, day = time.January, 1
+	case PrecisionMonth:
+		day = 1
+	default:
+		precision = PrecisionDay
+	}
+	return Date{
+		Time:      time.Date(year, month, day, 0, 0, 0, 0, time.UTC),
+		Precision: precision,
+	}
+}
+
+// String renders the date without the unknown parts: 2006-01-02, 2006-01 or 2006.
+func (d Date) String() string {
+	switch d.Precision {
+	case PrecisionYear:
+		return d.Time.Format("2006")
+	case PrecisionMonth:
+		return d.Time.Format("2006-01")
+	default:
+		return d.Time.Format("2006-01-02")
+	}
+}
+
+// End returns the first day after the period the date covers.
+func (d Date) End() time.Time {
+	switch d.Precision {
+	case PrecisionYear:
+		return d.Time.AddDate(1, 0, 0)
+	case PrecisionMonth:
+		return d.Time.AddDate(0, 1, 0)
+	default:
+		return d.Time.AddDate(0, 0, 1)
+	}
+}
+
+func layoutPrecision(layout string) Precision {
+	rest := strings.ReplaceAll(layout, "2006", "")
+	switch {
+	case strings.Contains(rest, "2"):
+		return PrecisionDay
+	case strings.Contains(rest, "1") || strings.Contains(rest, "Jan"):
+		return PrecisionMonth
+	default:
+		return PrecisionYear
+	}
+}
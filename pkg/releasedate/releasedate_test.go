@@ -0,0 +1,90 @@
+package releasedate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      time.Time
+		precision Precision
+		str       string
+		err       error
+	}{
+		{value: "2009-09-14", want: day(2009, 9, 14), precision: PrecisionDay, str: "2009-09-14"},
+		{value: "2009-09-14T22:30:00+03:00", want: day(2009, 9, 14), precision: PrecisionDay, str: "2009-09-14"},
+		{value: "14.09.2009", want: day(2009, 9, 14), precision: PrecisionDay, str: "2009-09-14"},
+		{value: " 2009-09 ", want: day(2009, 9, 1), precision: PrecisionMonth, str: "2009-09"},
+		{value: "2009", want: day(2009, 1, 1), precision: PrecisionYear, str: "2009"},
+		{value: "2009-02-30", err: ErrInvalidDate},
+		{value: "14/09/2009", err: ErrInvalidDate},
+		{value: "", err: ErrInvalidDate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !got.Time.Equal(tt.want) || got.Precision != tt.precision || got.String() != tt.str {
+				t.Errorf("Parse(%q) = %s (%s), want %s (%s)", tt.value, got.Time, got.Precision, tt.want, tt.precision)
+			}
+		})
+	}
+}
+
+func TestParseLayout(t *testing.T) {
+	tests := []struct {
+		value, layout string
+		want          string
+	}{
+		{"09/14/2009", "01/02/2006", "2009-09-14"},
+		{"Sep 2009", "Jan 2006", "2009-09"},
+		{"09.2009", "01.2006", "2009-09"},
+		{"'09", "'06", "2009"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			got, err := ParseLayout(tt.value, tt.layout)
+			if err != nil {
+				t.Fatalf("ParseLayout: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseLayout(%q, %q) = %s, want %s", tt.value, tt.layout, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnd(t *testing.T) {
+	tests := []struct {
+		date Date
+		want time.Time
+	}{
+		{Date{Time: day(2009, 9, 14), Precision: PrecisionDay}, day(2009, 9, 15)},
+		{Date{Time: day(2009, 12, 31), Precision: PrecisionDay}, day(2010, 1, 1)},
+		{Date{Time: day(2009, 9, 1), Precision: PrecisionMonth}, day(2009, 10, 1)},
+		{Date{Time: day(2009, 12, 1), Precision: PrecisionMonth}, day(2010, 1, 1)},
+		{Date{Time: day(2009, 1, 1), Precision: PrecisionYear}, day(2010, 1, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.date.String(), func(t *testing.T) {
+			if got := tt.date.End(); !got.Equal(tt.want) {
+				t.Errorf("End() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}